@@ -6,6 +6,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
@@ -13,7 +14,9 @@ import (
 	"k8s.io/client-go/rest"
 
 	osconfigv1 "github.com/openshift/api/config/v1"
+	routev1 "github.com/openshift/api/route/v1"
 	"github.com/openshift/cluster-baremetal-operator/pkg/apis"
+	metal3v1alpha1 "github.com/openshift/cluster-baremetal-operator/pkg/apis/metal3/v1alpha1"
 	"github.com/openshift/cluster-baremetal-operator/pkg/controller"
 	"github.com/openshift/cluster-baremetal-operator/version"
 
@@ -38,6 +41,13 @@ var (
 	metricsPort         int32 = 8383
 	operatorMetricsPort int32 = 8686
 )
+
+// The validating webhook is served with the certificate that the service
+// CA operator generates for the webhook Service.
+var (
+	webhookPort    = 9443
+	webhookCertDir = "/etc/cluster-baremetal-operator/tls"
+)
 var log = logf.Log.WithName("cmd")
 
 func printVersion() {
@@ -95,6 +105,8 @@ func main() {
 	mgr, err := manager.New(cfg, manager.Options{
 		Namespace:          namespace,
 		MetricsBindAddress: fmt.Sprintf("%s:%d", metricsHost, metricsPort),
+		Port:               webhookPort,
+		CertDir:            webhookCertDir,
 	})
 	if err != nil {
 		log.Error(err, "")
@@ -112,6 +124,10 @@ func main() {
 		log.Error(err, "")
 		os.Exit(1)
 	}
+	if err := routev1.Install(mgr.GetScheme()); err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
 
 	// Setup all Controllers
 	if err := controller.AddToManager(mgr); err != nil {
@@ -119,6 +135,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Setup the validating webhook, but only when a serving certificate is
+	// available; it is not when running the operator locally.
+	if _, err := os.Stat(filepath.Join(webhookCertDir, "tls.crt")); err == nil {
+		(&metal3v1alpha1.Provisioning{}).SetupWebhookWithManager(mgr)
+	} else {
+		log.Info("Skipping webhook setup; no serving certificate found.", "CertDir", webhookCertDir)
+	}
+
 	// Add the Metrics Service
 	addMetrics(ctx, cfg, namespace)
 
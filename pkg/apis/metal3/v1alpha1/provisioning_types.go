@@ -1,6 +1,8 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	operatorv1 "github.com/openshift/api/operator/v1"
@@ -26,11 +28,117 @@ type Provisioning struct {
 	Status ProvisioningStatus `json:"status,omitempty"`
 }
 
+// IPv6AddressMode defines how hosts on an IPv6 provisioning network
+// obtain their addresses.
+type IPv6AddressMode string
+
+const (
+	// IPv6AddressModeDHCPv6Stateful hands out addresses from the DHCP
+	// range using stateful DHCPv6.
+	IPv6AddressModeDHCPv6Stateful IPv6AddressMode = "DHCPv6Stateful"
+
+	// IPv6AddressModeDHCPv6Stateless lets hosts configure their
+	// addresses from router advertisements (SLAAC) and uses DHCPv6 only
+	// to hand out the remaining options, such as the boot file.
+	IPv6AddressModeDHCPv6Stateless IPv6AddressMode = "DHCPv6Stateless"
+
+	// IPv6AddressModeSLAAC sends router advertisements only; no DHCPv6
+	// service is offered.
+	IPv6AddressModeSLAAC IPv6AddressMode = "SLAAC"
+)
+
+// ProvisioningNetwork defines how the metal3 cluster uses the
+// provisioning network.
+type ProvisioningNetwork string
+
+const (
+	// ProvisioningNetworkManaged runs the DHCP server for the
+	// provisioning network within the metal3 cluster, and hosts are
+	// booted over the network.
+	ProvisioningNetworkManaged ProvisioningNetwork = "Managed"
+
+	// ProvisioningNetworkUnmanaged uses a DHCP server external to the
+	// metal3 cluster, and hosts are booted over the network.
+	ProvisioningNetworkUnmanaged ProvisioningNetwork = "Unmanaged"
+
+	// ProvisioningNetworkDisabled is used when there is no
+	// provisioning network. Hosts are only deployed through virtual
+	// media provided by their BMC.
+	ProvisioningNetworkDisabled ProvisioningNetwork = "Disabled"
+)
+
+// WorkloadLayout defines how the metal3 components are split into
+// workloads.
+type WorkloadLayout string
+
+const (
+	// WorkloadLayoutCombined runs every metal3 component in a single pod.
+	WorkloadLayoutCombined WorkloadLayout = "Combined"
+
+	// WorkloadLayoutSplit runs the baremetal-operator in a Deployment
+	// of its own, separate from the Ironic components, so that each is
+	// rolled out and restarted independently.
+	WorkloadLayoutSplit WorkloadLayout = "Split"
+)
+
+// ProvisioningStorage configures the persistent volumes of the metal3 pod.
+type ProvisioningStorage struct {
+	// StorageClassName is the StorageClass of the persistent volume
+	// claims. The default StorageClass of the cluster is used when it
+	// is not set. It only applies when a claim is created.
+	StorageClassName string `json:"storageClassName,omitempty"`
+
+	// ImageCacheSize is the size of the volume holding the images
+	// served to hosts, including the machine OS image. It defaults to
+	// 20Gi, and may be increased later if the StorageClass allows
+	// volume expansion.
+	ImageCacheSize *resource.Quantity `json:"imageCacheSize,omitempty"`
+
+	// DatabaseSize is the size of the volume holding the Ironic
+	// database. It defaults to 1Gi, and may be increased later if the
+	// StorageClass allows volume expansion.
+	DatabaseSize *resource.Quantity `json:"databaseSize,omitempty"`
+}
+
+// Metal3ContainerNames are the names of the containers run by the metal3
+// workloads, whose resources may be overridden.
+var Metal3ContainerNames = []string{
+	"metal3-baremetal-operator",
+	"metal3-dnsmasq",
+	"metal3-mariadb",
+	"metal3-httpd",
+	"metal3-ironic-conductor",
+	"metal3-ironic-api",
+	"metal3-ironic-inspector",
+	"metal3-static-ip-manager",
+	"metal3-ipa-downloader",
+	"metal3-machine-os-downloader",
+	"metal3-static-ip-set",
+	"metal3-htpasswd-generator",
+	"metal3-host-firewall",
+}
+
+// ContainerResources overrides the compute resources of one of the metal3
+// containers.
+type ContainerResources struct {
+	// Name is the name of the container, such as
+	// metal3-ironic-conductor.
+	// +kubebuilder:validation:Enum=metal3-baremetal-operator;metal3-dnsmasq;metal3-mariadb;metal3-httpd;metal3-ironic-conductor;metal3-ironic-api;metal3-ironic-inspector;metal3-static-ip-manager;metal3-ipa-downloader;metal3-machine-os-downloader;metal3-static-ip-set;metal3-htpasswd-generator;metal3-host-firewall
+	Name string `json:"name"`
+
+	// Resources are the requests and limits of cpu, memory and
+	// ephemeral-storage of the container. Each request replaces the
+	// default request of its resource. A limit below the default
+	// request also lowers the request to the limit.
+	Resources corev1.ResourceRequirements `json:"resources"`
+}
+
 // ProvisioningSpec defines the provisioning configuration for Metal3.
 type ProvisioningSpec struct {
 	// ProvisioningInterface is the name of the network interface
 	// on a baremetal server to the provisioning network. It can
-	// have values like eth1 or ens3.
+	// have values like eth1 or ens3. It is optional when the
+	// ProvisioningNetwork is Disabled.
 	ProvisioningInterface string `json:"provisioningInterface,omitempty"`
 
 	// ProvisioningIP is the IP address assigned to the
@@ -41,12 +149,15 @@ type ProvisioningSpec struct {
 
 	// ProvisioningNetworkCIDR is the network on which the
 	// baremetal nodes are provisioned. The provisioningIP and the
-	// IPs in the dhcpRange all come from within this network.
+	// IPs in the dhcpRange all come from within this network. It
+	// is optional when the ProvisioningNetwork is Disabled.
 	ProvisioningNetworkCIDR string `json:"provisioningNetworkCIDR,omitempty"`
 
 	// ProvisioningDHCPExternal indicates whether the DHCP server
 	// for IP addresses in the provisioning DHCP range is present
-	// within the metal3 cluster or external to it.
+	// within the metal3 cluster or external to it. It is
+	// superseded by ProvisioningNetwork; setting it to True is
+	// equivalent to a ProvisioningNetwork of Unmanaged.
 	ProvisioningDHCPExternal bool `json:"provisioningDHCPExternal,omitempty"`
 
 	// ProvisioningDHCPRange needs to be interpreted along with
@@ -74,12 +185,146 @@ type ProvisioningSpec struct {
 	// Image used to boot baremetal host machines can be
 	// downloaded by the metal3 cluster.
 	ProvisioningOSDownloadURL string `json:"provisioningOSDownloadURL,omitempty"`
+
+	// ProvisioningSecondaryIP is an additional IP address assigned
+	// to the provisioningInterface on dual-stack provisioning
+	// networks. It must be of the other IP family than
+	// ProvisioningIP and lie within the
+	// ProvisioningSecondaryNetworkCIDR.
+	ProvisioningSecondaryIP string `json:"provisioningSecondaryIP,omitempty"`
+
+	// ProvisioningSecondaryNetworkCIDR is the network of the other
+	// IP family on dual-stack provisioning networks. It must be set
+	// together with ProvisioningSecondaryIP.
+	ProvisioningSecondaryNetworkCIDR string `json:"provisioningSecondaryNetworkCIDR,omitempty"`
+
+	// ProvisioningSecondaryDHCPRange is the DHCP range within the
+	// ProvisioningSecondaryNetworkCIDR. It is interpreted in the
+	// same way as ProvisioningDHCPRange, including the default
+	// range when it is not set, and may also be changed after the
+	// installer has created the CR.
+	ProvisioningSecondaryDHCPRange string `json:"provisioningSecondaryDHCPRange,omitempty"`
+
+	// ProvisioningIPv6AddressMode selects how hosts obtain their
+	// addresses on an IPv6 provisioning network when the DHCP
+	// server runs within the metal3 cluster. It can be one of
+	// DHCPv6Stateful, DHCPv6Stateless or SLAAC and defaults to
+	// DHCPv6Stateful. The DHCP range is only used in
+	// DHCPv6Stateful mode; the other modes require a /64 network.
+	// +kubebuilder:validation:Enum=DHCPv6Stateful;DHCPv6Stateless;SLAAC
+	ProvisioningIPv6AddressMode IPv6AddressMode `json:"provisioningIPv6AddressMode,omitempty"`
+
+	// ProvisioningNetwork selects how the provisioning network is
+	// used. It can be one of Managed, Unmanaged or Disabled. In
+	// Managed mode the DHCP server runs within the metal3 cluster,
+	// in Unmanaged mode it is external to it, and in Disabled mode
+	// there is no provisioning network and hosts are deployed
+	// through virtual media only. In Disabled mode the
+	// ProvisioningIP must already be configured on the host, as the
+	// metal3 cluster does not manage it. When it is not set, it is
+	// derived from ProvisioningDHCPExternal.
+	// +kubebuilder:validation:Enum=Managed;Unmanaged;Disabled
+	ProvisioningNetwork ProvisioningNetwork `json:"provisioningNetwork,omitempty"`
+
+	// VirtualMediaViaExternalNetwork makes the images used for
+	// virtual media boot available to BMCs on the external network.
+	// When set, the metal3-httpd container is exposed through a
+	// Route, and Ironic hands out the address of that Route instead
+	// of the ProvisioningIP when attaching virtual media.
+	VirtualMediaViaExternalNetwork bool `json:"virtualMediaViaExternalNetwork,omitempty"`
+
+	// WorkloadLayout selects how the metal3 components are deployed.
+	// It can be Combined, where they all run in the metal3 pod, or
+	// Split, where the baremetal-operator runs in the
+	// metal3-baremetal-operator Deployment, apart from Ironic,
+	// Ironic Inspector, httpd, dnsmasq and MariaDB. It defaults to
+	// Combined, and may be changed after the installer has created
+	// the CR.
+	// +kubebuilder:validation:Enum=Combined;Split
+	WorkloadLayout WorkloadLayout `json:"workloadLayout,omitempty"`
+
+	// Storage makes the image cache and the Ironic database of the
+	// metal3 pod persistent. When it is set, the operator creates a
+	// persistent volume claim for each, so that they outlive the pod;
+	// otherwise they are lost whenever the pod is rescheduled. The
+	// claims are kept when it is unset again.
+	Storage *ProvisioningStorage `json:"storage,omitempty"`
+
+	// ContainerResources overrides the resource requests and limits
+	// of the metal3 containers, each of which otherwise requests
+	// resources sized for a typical cluster. It may be changed after
+	// the installer has created the CR.
+	ContainerResources []ContainerResources `json:"containerResources,omitempty"`
+
+	// ManageHostFirewall makes the operator add firewall rules to the
+	// host running the metal3 pod, so that the Ironic, Ironic
+	// Inspector and httpd ports only accept connections arriving on
+	// the ProvisioningInterface from the provisioning networks.
+	// NetworkPolicies do not apply to the metal3 pod, which runs on
+	// the host network. The httpd ports are left open when
+	// VirtualMediaViaExternalNetwork is set. It cannot be set when the
+	// ProvisioningNetwork is Disabled, and may be changed after the
+	// installer has created the CR.
+	ManageHostFirewall bool `json:"manageHostFirewall,omitempty"`
+
+	// ManagementState tells the operator whether to manage the metal3
+	// components. It can be Managed, Unmanaged, where the operator
+	// leaves the components as they are so that they can be changed
+	// by hand, or Removed, where the operator deletes every object it
+	// created for them. It defaults to Managed, and may be changed
+	// after the installer has created the CR.
+	// +kubebuilder:validation:Enum=Managed;Unmanaged;Removed
+	ManagementState operatorv1.ManagementState `json:"managementState,omitempty"`
+}
+
+// ExposedPort describes a port the metal3 pod listens on.
+type ExposedPort struct {
+	// Name identifies the service listening on the port, such as
+	// ironic or dhcp.
+	Name string `json:"name"`
+
+	// Port is the number of the port.
+	Port int32 `json:"port"`
+
+	// Protocol is TCP or UDP.
+	Protocol corev1.Protocol `json:"protocol"`
+
+	// Interface is the network interface the port is bound to. It is
+	// empty when the port is bound to every interface.
+	Interface string `json:"interface,omitempty"`
+
+	// ListenAddress is the address the port is bound to. It is empty
+	// when the port is bound to every address of the host.
+	ListenAddress string `json:"listenAddress,omitempty"`
+
+	// ReachableFrom lists the networks connections to the port are
+	// accepted from, in CIDR notation.
+	ReachableFrom []string `json:"reachableFrom"`
 }
 
 // ProvisioningStatus defines the observed values from the
 // cluster. They may not be overridden.
 type ProvisioningStatus struct {
 	operatorv1.OperatorStatus `json:",inline"`
+
+	// AppliedSpec is the provisioning configuration that was last
+	// rendered into the metal3 deployment. Changes to fields that
+	// are immutable after creation are not applied; they are held
+	// back and reported through a condition instead.
+	AppliedSpec *ProvisioningSpec `json:"appliedSpec,omitempty"`
+
+	// EffectiveDHCPRange is the range of IP addresses handed out by
+	// the DHCP server running within the metal3 cluster. It is
+	// either the ProvisioningDHCPRange from the spec or, when that
+	// is not set, the default range computed from the
+	// ProvisioningNetworkCIDR. It is empty when the DHCP server is
+	// external, or when it does not hand out addresses from a range
+	// because the IPv6 address mode is not DHCPv6Stateful.
+	EffectiveDHCPRange string `json:"effectiveDHCPRange,omitempty"`
+
+	// ExposedPorts lists the ports the metal3 pod listens on, and
+	// the networks each is reachable from.
+	ExposedPorts []ExposedPort `json:"exposedPorts,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
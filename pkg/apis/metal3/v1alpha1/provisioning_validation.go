@@ -0,0 +1,379 @@
+package v1alpha1
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+)
+
+// ValidateBaremetalProvisioningConfig checks the Provisioning spec for
+// values that cannot be rendered into a working metal3 deployment.
+// All problems found are returned together as a single Invalid error
+// with one cause per offending field.
+func (prov *Provisioning) ValidateBaremetalProvisioningConfig() error {
+	allErrs := validateProvisioningSpec(&prov.Spec, field.NewPath("spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(SchemeGroupVersion.WithKind("Provisioning").GroupKind(), prov.Name, allErrs)
+}
+
+// ValidateBaremetalProvisioningConfigUpdate checks the Provisioning spec
+// like ValidateBaremetalProvisioningConfig, and additionally rejects
+// changes to any field other than the DHCP ranges relative to old.
+func (prov *Provisioning) ValidateBaremetalProvisioningConfigUpdate(old *ProvisioningSpec) error {
+	fldPath := field.NewPath("spec")
+	allErrs := validateProvisioningSpec(&prov.Spec, fldPath)
+	allErrs = append(allErrs, validateImmutableFields(&prov.Spec, old, fldPath)...)
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(SchemeGroupVersion.WithKind("Provisioning").GroupKind(), prov.Name, allErrs)
+}
+
+// ValidateImmutableFields returns an Invalid error listing each field
+// that differs from old but may not be changed after creation.
+func (prov *Provisioning) ValidateImmutableFields(old *ProvisioningSpec) error {
+	allErrs := validateImmutableFields(&prov.Spec, old, field.NewPath("spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(SchemeGroupVersion.WithKind("Provisioning").GroupKind(), prov.Name, allErrs)
+}
+
+func validateProvisioningSpec(spec *ProvisioningSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	networkPath := fldPath.Child("provisioningNetwork")
+	switch spec.ProvisioningNetwork {
+	case "", ProvisioningNetworkUnmanaged, ProvisioningNetworkDisabled:
+	case ProvisioningNetworkManaged:
+		if spec.ProvisioningDHCPExternal {
+			allErrs = append(allErrs, field.Invalid(networkPath, spec.ProvisioningNetwork, "conflicts with provisioningDHCPExternal"))
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(networkPath, spec.ProvisioningNetwork,
+			[]string{string(ProvisioningNetworkManaged), string(ProvisioningNetworkUnmanaged), string(ProvisioningNetworkDisabled)}))
+	}
+
+	switch spec.ManagementState {
+	case "", operatorv1.Managed, operatorv1.Unmanaged, operatorv1.Removed:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("managementState"), spec.ManagementState,
+			[]string{string(operatorv1.Managed), string(operatorv1.Unmanaged), string(operatorv1.Removed)}))
+	}
+
+	switch spec.WorkloadLayout {
+	case "", WorkloadLayoutCombined, WorkloadLayoutSplit:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("workloadLayout"), spec.WorkloadLayout,
+			[]string{string(WorkloadLayoutCombined), string(WorkloadLayoutSplit)}))
+	}
+
+	if spec.Storage != nil {
+		allErrs = append(allErrs, validateStorage(spec.Storage, fldPath.Child("storage"))...)
+	}
+
+	allErrs = append(allErrs, validateContainerResources(spec.ContainerResources, fldPath.Child("containerResources"))...)
+
+	if spec.ManageHostFirewall && spec.ProvisioningNetworkMode() == ProvisioningNetworkDisabled {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("manageHostFirewall"), spec.ManageHostFirewall, "requires a provisioning network"))
+	}
+
+	if spec.ProvisioningInterface == "" && spec.ProvisioningNetworkMode() != ProvisioningNetworkDisabled {
+		allErrs = append(allErrs, field.Required(fldPath.Child("provisioningInterface"), "the provisioning network interface must be set"))
+	}
+
+	modePath := fldPath.Child("provisioningIPv6AddressMode")
+	switch spec.ipv6AddressMode() {
+	case IPv6AddressModeDHCPv6Stateful, IPv6AddressModeDHCPv6Stateless, IPv6AddressModeSLAAC:
+	default:
+		allErrs = append(allErrs, field.NotSupported(modePath, spec.ProvisioningIPv6AddressMode,
+			[]string{string(IPv6AddressModeDHCPv6Stateful), string(IPv6AddressModeDHCPv6Stateless), string(IPv6AddressModeSLAAC)}))
+	}
+
+	primaryNet, errs := validateProvisioningNetwork(spec, spec.ProvisioningIP, spec.ProvisioningNetworkCIDR, spec.ProvisioningDHCPRange,
+		fldPath.Child("provisioningIP"), fldPath.Child("provisioningNetworkCIDR"), fldPath.Child("provisioningDHCPRange"))
+	allErrs = append(allErrs, errs...)
+	networks := []*net.IPNet{primaryNet}
+
+	// The secondary network makes the provisioning network dual-stack
+	if spec.ProvisioningSecondaryIP != "" || spec.ProvisioningSecondaryNetworkCIDR != "" || spec.ProvisioningSecondaryDHCPRange != "" {
+		secondaryCIDRPath := fldPath.Child("provisioningSecondaryNetworkCIDR")
+		secondaryNet, errs := validateProvisioningNetwork(spec, spec.ProvisioningSecondaryIP, spec.ProvisioningSecondaryNetworkCIDR, spec.ProvisioningSecondaryDHCPRange,
+			fldPath.Child("provisioningSecondaryIP"), secondaryCIDRPath, fldPath.Child("provisioningSecondaryDHCPRange"))
+		allErrs = append(allErrs, errs...)
+		if primaryNet != nil && secondaryNet != nil && isIPv6(primaryNet.IP) == isIPv6(secondaryNet.IP) {
+			allErrs = append(allErrs, field.Invalid(secondaryCIDRPath, spec.ProvisioningSecondaryNetworkCIDR, "must be of the other IP family than provisioningNetworkCIDR"))
+		}
+		networks = append(networks, secondaryNet)
+	}
+
+	if spec.ProvisioningIPv6AddressMode != "" {
+		hasIPv6 := false
+		for _, ipNet := range networks {
+			if ipNet != nil && isIPv6(ipNet.IP) {
+				hasIPv6 = true
+			}
+		}
+		if !hasIPv6 {
+			allErrs = append(allErrs, field.Invalid(modePath, spec.ProvisioningIPv6AddressMode, "only applies to IPv6 provisioning networks"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateStorage checks that the sizes of the persistent volumes, when
+// set, are positive.
+func validateStorage(storage *ProvisioningStorage, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if storage.ImageCacheSize != nil && storage.ImageCacheSize.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("imageCacheSize"), storage.ImageCacheSize.String(), "must be greater than zero"))
+	}
+	if storage.DatabaseSize != nil && storage.DatabaseSize.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("databaseSize"), storage.DatabaseSize.String(), "must be greater than zero"))
+	}
+	return allErrs
+}
+
+// validateContainerResources checks that each override names a different
+// metal3 container, and sets valid requests and limits of the supported
+// resources.
+func validateContainerResources(overrides []ContainerResources, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	knownNames := sets.NewString(Metal3ContainerNames...)
+	seenNames := sets.NewString()
+	for i, override := range overrides {
+		idxPath := fldPath.Index(i)
+		namePath := idxPath.Child("name")
+		if !knownNames.Has(override.Name) {
+			allErrs = append(allErrs, field.NotSupported(namePath, override.Name, Metal3ContainerNames))
+		} else if seenNames.Has(override.Name) {
+			allErrs = append(allErrs, field.Duplicate(namePath, override.Name))
+		}
+		seenNames.Insert(override.Name)
+
+		resourcesPath := idxPath.Child("resources")
+		allErrs = append(allErrs, validateResourceList(override.Resources.Requests, resourcesPath.Child("requests"))...)
+		allErrs = append(allErrs, validateResourceList(override.Resources.Limits, resourcesPath.Child("limits"))...)
+		for name, request := range override.Resources.Requests {
+			limit, ok := override.Resources.Limits[name]
+			if ok && request.Cmp(limit) > 0 {
+				allErrs = append(allErrs, field.Invalid(resourcesPath.Child("requests").Key(string(name)), request.String(),
+					fmt.Sprintf("must be less than or equal to the %s limit", name)))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+func validateResourceList(resources corev1.ResourceList, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for name, quantity := range resources {
+		switch name {
+		case corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourceEphemeralStorage:
+		default:
+			allErrs = append(allErrs, field.NotSupported(fldPath.Key(string(name)), name,
+				[]string{string(corev1.ResourceCPU), string(corev1.ResourceMemory), string(corev1.ResourceEphemeralStorage)}))
+			continue
+		}
+		if quantity.Sign() < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Key(string(name)), quantity.String(), "must be greater than or equal to zero"))
+		}
+	}
+	return allErrs
+}
+
+// validateProvisioningNetwork checks the IP, CIDR and DHCP range of one IP
+// family of the provisioning network, and returns the parsed CIDR if it is
+// valid.
+func validateProvisioningNetwork(spec *ProvisioningSpec, ip, cidr, dhcpRange string, ipPath, cidrPath, dhcpRangePath *field.Path) (*net.IPNet, field.ErrorList) {
+	allErrs := field.ErrorList{}
+
+	mode := spec.ProvisioningNetworkMode()
+
+	var provisioningNet *net.IPNet
+	if cidr == "" {
+		// Without a provisioning network, the CIDR only serves to
+		// check the provisioning IP
+		if mode != ProvisioningNetworkDisabled {
+			allErrs = append(allErrs, field.Required(cidrPath, "the provisioning network CIDR must be set"))
+		}
+	} else {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(cidrPath, cidr, "must be a valid CIDR, e.g. 172.22.0.0/24 or fd00:1101::/64"))
+		} else {
+			provisioningNet = ipNet
+		}
+	}
+
+	// Addresses are only handed out from the DHCP range by the internal
+	// DHCP server, and with IPv6 only in stateful DHCPv6 mode
+	usesDHCPRange := mode == ProvisioningNetworkManaged
+	if provisioningNet != nil && mode == ProvisioningNetworkManaged {
+		ones, bits := provisioningNet.Mask.Size()
+		if isIPv6(provisioningNet.IP) && spec.ipv6AddressMode() != IPv6AddressModeDHCPv6Stateful {
+			usesDHCPRange = false
+			if ones != 64 {
+				allErrs = append(allErrs, field.Invalid(cidrPath, cidr, fmt.Sprintf("must have a prefix length of 64 in %s mode", spec.ipv6AddressMode())))
+			}
+		} else if bits-ones < 2 {
+			// The internal DHCP server needs at least one address
+			// besides the provisioning IP to hand out
+			allErrs = append(allErrs, field.Invalid(cidrPath, cidr, "is too small for the internal DHCP server"))
+		}
+	}
+
+	var provisioningIP net.IP
+	if ip == "" {
+		allErrs = append(allErrs, field.Required(ipPath, "the provisioning IP must be set"))
+	} else {
+		provisioningIP = net.ParseIP(ip)
+		if provisioningIP == nil {
+			allErrs = append(allErrs, field.Invalid(ipPath, ip, "must be a valid IP address"))
+		} else if provisioningNet != nil && !provisioningNet.Contains(provisioningIP) {
+			allErrs = append(allErrs, field.Invalid(ipPath, ip, fmt.Sprintf("must be within the provisioning network %s", provisioningNet)))
+		}
+	}
+
+	if usesDHCPRange && dhcpRange != "" {
+		allErrs = append(allErrs, validateDHCPRange(dhcpRange, provisioningIP, provisioningNet, dhcpRangePath)...)
+	}
+
+	return provisioningNet, allErrs
+}
+
+// validateImmutableFields compares every field of the spec except the DHCP
+// ranges, the workload layout, the storage, the container resources, the
+// host firewall and the management state, which are the only ones that may
+// be changed after the installer has created the CR.
+func validateImmutableFields(spec, old *ProvisioningSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if spec.ProvisioningInterface != old.ProvisioningInterface {
+		allErrs = append(allErrs, immutableFieldError(fldPath.Child("provisioningInterface"), spec.ProvisioningInterface))
+	}
+	if spec.ProvisioningIP != old.ProvisioningIP {
+		allErrs = append(allErrs, immutableFieldError(fldPath.Child("provisioningIP"), spec.ProvisioningIP))
+	}
+	if spec.ProvisioningNetworkCIDR != old.ProvisioningNetworkCIDR {
+		allErrs = append(allErrs, immutableFieldError(fldPath.Child("provisioningNetworkCIDR"), spec.ProvisioningNetworkCIDR))
+	}
+	if spec.ProvisioningDHCPExternal != old.ProvisioningDHCPExternal {
+		allErrs = append(allErrs, immutableFieldError(fldPath.Child("provisioningDHCPExternal"), spec.ProvisioningDHCPExternal))
+	}
+	if spec.ProvisioningOSDownloadURL != old.ProvisioningOSDownloadURL {
+		allErrs = append(allErrs, immutableFieldError(fldPath.Child("provisioningOSDownloadURL"), spec.ProvisioningOSDownloadURL))
+	}
+	if spec.ProvisioningSecondaryIP != old.ProvisioningSecondaryIP {
+		allErrs = append(allErrs, immutableFieldError(fldPath.Child("provisioningSecondaryIP"), spec.ProvisioningSecondaryIP))
+	}
+	if spec.ProvisioningSecondaryNetworkCIDR != old.ProvisioningSecondaryNetworkCIDR {
+		allErrs = append(allErrs, immutableFieldError(fldPath.Child("provisioningSecondaryNetworkCIDR"), spec.ProvisioningSecondaryNetworkCIDR))
+	}
+	// Only the mode in effect matters, so that the default may be spelled
+	// out
+	if spec.ProvisioningNetworkMode() != old.ProvisioningNetworkMode() {
+		allErrs = append(allErrs, immutableFieldError(fldPath.Child("provisioningNetwork"), spec.ProvisioningNetwork))
+	}
+	if spec.VirtualMediaViaExternalNetwork != old.VirtualMediaViaExternalNetwork {
+		allErrs = append(allErrs, immutableFieldError(fldPath.Child("virtualMediaViaExternalNetwork"), spec.VirtualMediaViaExternalNetwork))
+	}
+	if spec.ProvisioningIPv6AddressMode != old.ProvisioningIPv6AddressMode {
+		allErrs = append(allErrs, immutableFieldError(fldPath.Child("provisioningIPv6AddressMode"), spec.ProvisioningIPv6AddressMode))
+	}
+
+	return allErrs
+}
+
+func immutableFieldError(fldPath *field.Path, value interface{}) *field.Error {
+	return field.Invalid(fldPath, value, "field is immutable")
+}
+
+func validateDHCPRange(dhcpRange string, provisioningIP net.IP, provisioningNet *net.IPNet, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	start, end, err := parseDHCPRange(dhcpRange)
+	if err != nil {
+		return append(allErrs, field.Invalid(fldPath, dhcpRange, err.Error()))
+	}
+
+	if provisioningNet != nil {
+		for _, ip := range []net.IP{start, end} {
+			if !provisioningNet.Contains(ip) {
+				allErrs = append(allErrs, field.Invalid(fldPath, dhcpRange, fmt.Sprintf("%s is not within the provisioning network %s", ip, provisioningNet)))
+			}
+		}
+	}
+	if bytes.Compare(start.To16(), end.To16()) > 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath, dhcpRange, "the start of the range must not be after the end"))
+	} else if provisioningIP != nil && ipInRange(provisioningIP, start, end) {
+		allErrs = append(allErrs, field.Invalid(fldPath, dhcpRange, fmt.Sprintf("must not include the provisioning IP %s", provisioningIP)))
+	}
+
+	return allErrs
+}
+
+// parseDHCPRange splits a range of the form "<start>,<end>" into its
+// two addresses. Whitespace around either address is ignored.
+func parseDHCPRange(dhcpRange string) (net.IP, net.IP, error) {
+	parts := strings.Split(dhcpRange, ",")
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("must be two comma separated IP addresses")
+	}
+	start := net.ParseIP(strings.TrimSpace(parts[0]))
+	end := net.ParseIP(strings.TrimSpace(parts[1]))
+	if start == nil || end == nil {
+		return nil, nil, fmt.Errorf("must be two comma separated IP addresses")
+	}
+	return start, end, nil
+}
+
+// ProvisioningNetworkMode returns the ProvisioningNetwork mode, deriving
+// it from ProvisioningDHCPExternal when it is not set.
+func (spec *ProvisioningSpec) ProvisioningNetworkMode() ProvisioningNetwork {
+	if spec.ProvisioningNetwork != "" {
+		return spec.ProvisioningNetwork
+	}
+	if spec.ProvisioningDHCPExternal {
+		return ProvisioningNetworkUnmanaged
+	}
+	return ProvisioningNetworkManaged
+}
+
+// OperatorManagementState returns the ManagementState, applying the
+// default.
+func (spec *ProvisioningSpec) OperatorManagementState() operatorv1.ManagementState {
+	if spec.ManagementState == "" {
+		return operatorv1.Managed
+	}
+	return spec.ManagementState
+}
+
+// ipv6AddressMode returns the IPv6 address mode, applying the default
+func (spec *ProvisioningSpec) ipv6AddressMode() IPv6AddressMode {
+	if spec.ProvisioningIPv6AddressMode == "" {
+		return IPv6AddressModeDHCPv6Stateful
+	}
+	return spec.ProvisioningIPv6AddressMode
+}
+
+func isIPv6(ip net.IP) bool {
+	return ip.To4() == nil
+}
+
+func ipInRange(ip, start, end net.IP) bool {
+	return bytes.Compare(ip.To16(), start.To16()) >= 0 && bytes.Compare(ip.To16(), end.To16()) <= 0
+}
@@ -0,0 +1,460 @@
+package v1alpha1
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+)
+
+func validProvisioningSpec() ProvisioningSpec {
+	return ProvisioningSpec{
+		ProvisioningInterface:     "ensp0",
+		ProvisioningIP:            "172.30.20.3",
+		ProvisioningNetworkCIDR:   "172.30.20.0/24",
+		ProvisioningDHCPExternal:  false,
+		ProvisioningDHCPRange:     "172.30.20.11, 172.30.20.101",
+		ProvisioningOSDownloadURL: "http://172.22.0.1/images/rhcos-44.81.202001171431.0-openstack.x86_64.qcow2.gz",
+	}
+}
+
+func TestValidateBaremetalProvisioningConfig(t *testing.T) {
+	tCases := []struct {
+		name          string
+		mutate        func(*ProvisioningSpec)
+		expectedError string
+	}{
+		{
+			name:   "Valid",
+			mutate: func(*ProvisioningSpec) {},
+		},
+		{
+			name:   "ValidExternalDHCPIgnoresRange",
+			mutate: func(s *ProvisioningSpec) { s.ProvisioningDHCPExternal = true; s.ProvisioningDHCPRange = "bogus" },
+		},
+		{
+			name:   "ValidEmptyRange",
+			mutate: func(s *ProvisioningSpec) { s.ProvisioningDHCPRange = "" },
+		},
+		{
+			name:          "MissingInterface",
+			mutate:        func(s *ProvisioningSpec) { s.ProvisioningInterface = "" },
+			expectedError: "spec.provisioningInterface: Required value",
+		},
+		{
+			name:          "MalformedCIDR",
+			mutate:        func(s *ProvisioningSpec) { s.ProvisioningNetworkCIDR = "172.30.20.0/33" },
+			expectedError: "spec.provisioningNetworkCIDR: Invalid value",
+		},
+		{
+			name:          "CIDRTooSmallForDHCP",
+			mutate:        func(s *ProvisioningSpec) { s.ProvisioningNetworkCIDR = "172.30.20.2/31"; s.ProvisioningDHCPRange = "" },
+			expectedError: "is too small for the internal DHCP server",
+		},
+		{
+			name: "SmallCIDRWithExternalDHCP",
+			mutate: func(s *ProvisioningSpec) {
+				s.ProvisioningNetworkCIDR = "172.30.20.3/32"
+				s.ProvisioningDHCPExternal = true
+			},
+		},
+		{
+			name:          "MalformedIP",
+			mutate:        func(s *ProvisioningSpec) { s.ProvisioningIP = "172.30.20.300" },
+			expectedError: "spec.provisioningIP: Invalid value",
+		},
+		{
+			name:          "IPOutsideCIDR",
+			mutate:        func(s *ProvisioningSpec) { s.ProvisioningIP = "172.30.21.3" },
+			expectedError: "must be within the provisioning network",
+		},
+		{
+			name:          "MalformedRange",
+			mutate:        func(s *ProvisioningSpec) { s.ProvisioningDHCPRange = "172.30.20.11" },
+			expectedError: "spec.provisioningDHCPRange: Invalid value",
+		},
+		{
+			name:          "RangeOutsideCIDR",
+			mutate:        func(s *ProvisioningSpec) { s.ProvisioningDHCPRange = "172.30.20.11,172.30.21.101" },
+			expectedError: "172.30.21.101 is not within the provisioning network",
+		},
+		{
+			name:          "RangeReversed",
+			mutate:        func(s *ProvisioningSpec) { s.ProvisioningDHCPRange = "172.30.20.101,172.30.20.11" },
+			expectedError: "must not be after the end",
+		},
+		{
+			name:          "RangeCoversProvisioningIP",
+			mutate:        func(s *ProvisioningSpec) { s.ProvisioningDHCPRange = "172.30.20.2,172.30.20.101" },
+			expectedError: "must not include the provisioning IP",
+		},
+		{
+			name: "ValidUnmanagedIgnoresRange",
+			mutate: func(s *ProvisioningSpec) {
+				s.ProvisioningNetwork = ProvisioningNetworkUnmanaged
+				s.ProvisioningDHCPRange = "bogus"
+			},
+		},
+		{
+			name: "ValidDisabledWithoutNetwork",
+			mutate: func(s *ProvisioningSpec) {
+				s.ProvisioningNetwork = ProvisioningNetworkDisabled
+				s.ProvisioningInterface = ""
+				s.ProvisioningNetworkCIDR = ""
+				s.ProvisioningDHCPRange = ""
+			},
+		},
+		{
+			name: "DisabledRequiresIP",
+			mutate: func(s *ProvisioningSpec) {
+				s.ProvisioningNetwork = ProvisioningNetworkDisabled
+				s.ProvisioningIP = ""
+			},
+			expectedError: "spec.provisioningIP: Required value",
+		},
+		{
+			name:          "UnknownProvisioningNetwork",
+			mutate:        func(s *ProvisioningSpec) { s.ProvisioningNetwork = "Bridged" },
+			expectedError: "spec.provisioningNetwork: Unsupported value",
+		},
+		{
+			name: "ManagedWithDHCPExternal",
+			mutate: func(s *ProvisioningSpec) {
+				s.ProvisioningNetwork = ProvisioningNetworkManaged
+				s.ProvisioningDHCPExternal = true
+			},
+			expectedError: "conflicts with provisioningDHCPExternal",
+		},
+		{
+			name:   "ValidSplitWorkloadLayout",
+			mutate: func(s *ProvisioningSpec) { s.WorkloadLayout = WorkloadLayoutSplit },
+		},
+		{
+			name:          "UnknownWorkloadLayout",
+			mutate:        func(s *ProvisioningSpec) { s.WorkloadLayout = "Sharded" },
+			expectedError: "spec.workloadLayout: Unsupported value",
+		},
+		{
+			name:   "ValidStorage",
+			mutate: func(s *ProvisioningSpec) { s.Storage = &ProvisioningStorage{StorageClassName: "standard"} },
+		},
+		{
+			name: "ValidStorageSizes",
+			mutate: func(s *ProvisioningSpec) {
+				imageCacheSize := resource.MustParse("50Gi")
+				s.Storage = &ProvisioningStorage{ImageCacheSize: &imageCacheSize}
+			},
+		},
+		{
+			name: "ZeroDatabaseSize",
+			mutate: func(s *ProvisioningSpec) {
+				databaseSize := resource.MustParse("0")
+				s.Storage = &ProvisioningStorage{DatabaseSize: &databaseSize}
+			},
+			expectedError: "spec.storage.databaseSize: Invalid value: \"0\": must be greater than zero",
+		},
+		{
+			name:   "ValidManagementState",
+			mutate: func(s *ProvisioningSpec) { s.ManagementState = operatorv1.Removed },
+		},
+		{
+			name:          "UnsupportedManagementState",
+			mutate:        func(s *ProvisioningSpec) { s.ManagementState = operatorv1.Force },
+			expectedError: `spec.managementState: Unsupported value: "Force": supported values: "Managed", "Unmanaged", "Removed"`,
+		},
+		{
+			name:   "ValidManageHostFirewall",
+			mutate: func(s *ProvisioningSpec) { s.ManageHostFirewall = true },
+		},
+		{
+			name: "ManageHostFirewallWithoutProvisioningNetwork",
+			mutate: func(s *ProvisioningSpec) {
+				s.ProvisioningNetwork = ProvisioningNetworkDisabled
+				s.ManageHostFirewall = true
+			},
+			expectedError: "spec.manageHostFirewall: Invalid value: true: requires a provisioning network",
+		},
+		{
+			name: "ValidContainerResources",
+			mutate: func(s *ProvisioningSpec) {
+				s.ContainerResources = []ContainerResources{
+					{
+						Name: "metal3-ironic-conductor",
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("500Mi")},
+							Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+						},
+					},
+				}
+			},
+		},
+		{
+			name: "UnknownContainerResources",
+			mutate: func(s *ProvisioningSpec) {
+				s.ContainerResources = []ContainerResources{{Name: "metal3-ironic"}}
+			},
+			expectedError: "spec.containerResources[0].name: Unsupported value: \"metal3-ironic\"",
+		},
+		{
+			name: "DuplicateContainerResources",
+			mutate: func(s *ProvisioningSpec) {
+				s.ContainerResources = []ContainerResources{{Name: "metal3-httpd"}, {Name: "metal3-httpd"}}
+			},
+			expectedError: "spec.containerResources[1].name: Duplicate value: \"metal3-httpd\"",
+		},
+		{
+			name: "UnsupportedContainerResource",
+			mutate: func(s *ProvisioningSpec) {
+				s.ContainerResources = []ContainerResources{
+					{
+						Name: "metal3-httpd",
+						Resources: corev1.ResourceRequirements{
+							Limits: corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("1")},
+						},
+					},
+				}
+			},
+			expectedError: "spec.containerResources[0].resources.limits[nvidia.com/gpu]: Unsupported value",
+		},
+		{
+			name: "ContainerRequestAboveLimit",
+			mutate: func(s *ProvisioningSpec) {
+				s.ContainerResources = []ContainerResources{
+					{
+						Name: "metal3-mariadb",
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m")},
+							Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+						},
+					},
+				}
+			},
+			expectedError: "spec.containerResources[0].resources.requests[cpu]: Invalid value: \"200m\": must be less than or equal to the cpu limit",
+		},
+	}
+
+	tCases = append(tCases, ipv6ValidationCases...)
+
+	for _, tc := range tCases {
+		t.Run(tc.name, func(t *testing.T) {
+			prov := &Provisioning{Spec: validProvisioningSpec()}
+			tc.mutate(&prov.Spec)
+
+			err := prov.ValidateBaremetalProvisioningConfig()
+			if tc.expectedError == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error containing %q, got nil", tc.expectedError)
+			}
+			if !strings.Contains(err.Error(), tc.expectedError) {
+				t.Errorf("expected error containing %q, got %q", tc.expectedError, err.Error())
+			}
+		})
+	}
+}
+
+func TestValidateBaremetalProvisioningConfigUpdate(t *testing.T) {
+	tCases := []struct {
+		name          string
+		mutate        func(*ProvisioningSpec)
+		expectedError string
+	}{
+		{
+			name:   "Unchanged",
+			mutate: func(*ProvisioningSpec) {},
+		},
+		{
+			name:   "DHCPRangeChanged",
+			mutate: func(s *ProvisioningSpec) { s.ProvisioningDHCPRange = "172.30.20.20, 172.30.20.120" },
+		},
+		{
+			name:   "WorkloadLayoutChanged",
+			mutate: func(s *ProvisioningSpec) { s.WorkloadLayout = WorkloadLayoutSplit },
+		},
+		{
+			name:   "StorageAdded",
+			mutate: func(s *ProvisioningSpec) { s.Storage = &ProvisioningStorage{} },
+		},
+		{
+			name:   "ManagementStateChanged",
+			mutate: func(s *ProvisioningSpec) { s.ManagementState = operatorv1.Unmanaged },
+		},
+		{
+			name:   "ManageHostFirewallChanged",
+			mutate: func(s *ProvisioningSpec) { s.ManageHostFirewall = true },
+		},
+		{
+			name: "ContainerResourcesAdded",
+			mutate: func(s *ProvisioningSpec) {
+				s.ContainerResources = []ContainerResources{{Name: "metal3-httpd"}}
+			},
+		},
+		{
+			name:          "ProvisioningIPChanged",
+			mutate:        func(s *ProvisioningSpec) { s.ProvisioningIP = "172.30.20.4" },
+			expectedError: "spec.provisioningIP: Invalid value: \"172.30.20.4\": field is immutable",
+		},
+		{
+			name:          "ProvisioningInterfaceChanged",
+			mutate:        func(s *ProvisioningSpec) { s.ProvisioningInterface = "ensp1" },
+			expectedError: "spec.provisioningInterface: Invalid value: \"ensp1\": field is immutable",
+		},
+		{
+			name:          "DHCPExternalChanged",
+			mutate:        func(s *ProvisioningSpec) { s.ProvisioningDHCPExternal = true },
+			expectedError: "spec.provisioningDHCPExternal: Invalid value: true: field is immutable",
+		},
+		{
+			name:          "VirtualMediaViaExternalNetworkChanged",
+			mutate:        func(s *ProvisioningSpec) { s.VirtualMediaViaExternalNetwork = true },
+			expectedError: "spec.virtualMediaViaExternalNetwork: Invalid value: true: field is immutable",
+		},
+		{
+			name:   "ProvisioningNetworkDefaultSpelledOut",
+			mutate: func(s *ProvisioningSpec) { s.ProvisioningNetwork = ProvisioningNetworkManaged },
+		},
+		{
+			name:          "ProvisioningNetworkChanged",
+			mutate:        func(s *ProvisioningSpec) { s.ProvisioningNetwork = ProvisioningNetworkDisabled },
+			expectedError: "spec.provisioningNetwork: Invalid value: \"Disabled\": field is immutable",
+		},
+	}
+
+	for _, tc := range tCases {
+		t.Run(tc.name, func(t *testing.T) {
+			old := validProvisioningSpec()
+			prov := &Provisioning{Spec: validProvisioningSpec()}
+			tc.mutate(&prov.Spec)
+
+			err := prov.ValidateBaremetalProvisioningConfigUpdate(&old)
+			if tc.expectedError == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error containing %q, got nil", tc.expectedError)
+			}
+			if !strings.Contains(err.Error(), tc.expectedError) {
+				t.Errorf("expected error containing %q, got %q", tc.expectedError, err.Error())
+			}
+		})
+	}
+}
+
+var ipv6ValidationCases = []struct {
+	name          string
+	mutate        func(*ProvisioningSpec)
+	expectedError string
+}{
+	{
+		name:   "ValidIPv6",
+		mutate: setIPv6Network,
+	},
+	{
+		name: "ValidIPv6SLAAC",
+		mutate: func(s *ProvisioningSpec) {
+			setIPv6Network(s)
+			s.ProvisioningIPv6AddressMode = IPv6AddressModeSLAAC
+		},
+	},
+	{
+		name: "IPv6SLAACRequiresSlash64",
+		mutate: func(s *ProvisioningSpec) {
+			setIPv6Network(s)
+			s.ProvisioningNetworkCIDR = "fd00:1101::/80"
+			s.ProvisioningIPv6AddressMode = IPv6AddressModeDHCPv6Stateless
+		},
+		expectedError: "must have a prefix length of 64 in DHCPv6Stateless mode",
+	},
+	{
+		name: "IPv6RangeOutsideCIDR",
+		mutate: func(s *ProvisioningSpec) {
+			setIPv6Network(s)
+			s.ProvisioningDHCPRange = "fd00:1101::10,fd00:1102::100"
+		},
+		expectedError: "fd00:1102::100 is not within the provisioning network",
+	},
+	{
+		name: "IPv4RangeOnIPv6Network",
+		mutate: func(s *ProvisioningSpec) {
+			setIPv6Network(s)
+			s.ProvisioningDHCPRange = "172.30.20.11,172.30.20.101"
+		},
+		expectedError: "172.30.20.11 is not within the provisioning network",
+	},
+	{
+		name: "UnknownIPv6AddressMode",
+		mutate: func(s *ProvisioningSpec) {
+			setIPv6Network(s)
+			s.ProvisioningIPv6AddressMode = "DHCPv7"
+		},
+		expectedError: "spec.provisioningIPv6AddressMode: Unsupported value",
+	},
+	{
+		name:          "IPv6AddressModeOnIPv4Network",
+		mutate:        func(s *ProvisioningSpec) { s.ProvisioningIPv6AddressMode = IPv6AddressModeSLAAC },
+		expectedError: "only applies to IPv6 provisioning networks",
+	},
+	{
+		name: "ValidDualStack",
+		mutate: func(s *ProvisioningSpec) {
+			s.ProvisioningSecondaryIP = "fd00:1101::3"
+			s.ProvisioningSecondaryNetworkCIDR = "fd00:1101::/64"
+			s.ProvisioningSecondaryDHCPRange = "fd00:1101::10,fd00:1101::100"
+		},
+	},
+	{
+		name: "DualStackSameFamily",
+		mutate: func(s *ProvisioningSpec) {
+			s.ProvisioningSecondaryIP = "172.30.21.3"
+			s.ProvisioningSecondaryNetworkCIDR = "172.30.21.0/24"
+		},
+		expectedError: "must be of the other IP family than provisioningNetworkCIDR",
+	},
+	{
+		name:          "DualStackMissingCIDR",
+		mutate:        func(s *ProvisioningSpec) { s.ProvisioningSecondaryIP = "fd00:1101::3" },
+		expectedError: "spec.provisioningSecondaryNetworkCIDR: Required value",
+	},
+	{
+		name: "DualStackRangeCoversIP",
+		mutate: func(s *ProvisioningSpec) {
+			s.ProvisioningSecondaryIP = "fd00:1101::3"
+			s.ProvisioningSecondaryNetworkCIDR = "fd00:1101::/64"
+			s.ProvisioningSecondaryDHCPRange = "fd00:1101::1,fd00:1101::100"
+		},
+		expectedError: "spec.provisioningSecondaryDHCPRange: Invalid value",
+	},
+}
+
+func setIPv6Network(s *ProvisioningSpec) {
+	s.ProvisioningIP = "fd00:1101::3"
+	s.ProvisioningNetworkCIDR = "fd00:1101::/64"
+	s.ProvisioningDHCPRange = "fd00:1101::10,fd00:1101::100"
+}
+
+func TestValidateUpdate(t *testing.T) {
+	old := &Provisioning{Spec: validProvisioningSpec()}
+	old.Spec.ProvisioningIP = "not-an-ip"
+
+	// An invalid CR may still be given finalizers or have them removed
+	prov := old.DeepCopy()
+	prov.Finalizers = []string{"example.com/finalizer"}
+	if err := prov.ValidateUpdate(old); err != nil {
+		t.Errorf("Expected updates leaving the spec unchanged to be allowed, got %v", err)
+	}
+
+	prov.Spec.ProvisioningDHCPRange = "172.30.20.20, 172.30.20.120"
+	if err := prov.ValidateUpdate(old); err == nil {
+		t.Errorf("Expected changes to an invalid spec to be rejected")
+	}
+}
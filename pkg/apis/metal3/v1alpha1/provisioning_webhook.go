@@ -0,0 +1,48 @@
+package v1alpha1
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// ProvisioningValidatingWebhookPath is the path on which the operator
+// serves the Provisioning validating webhook. It must match the path
+// in the ValidatingWebhookConfiguration manifest.
+const ProvisioningValidatingWebhookPath = "/validate-metal3-io-v1alpha1-provisioning"
+
+// blank assignment to verify that Provisioning implements admission.Validator
+var _ admission.Validator = &Provisioning{}
+
+// SetupWebhookWithManager registers the Provisioning validating
+// webhook with the webhook server of mgr.
+func (prov *Provisioning) SetupWebhookWithManager(mgr manager.Manager) {
+	mgr.GetWebhookServer().Register(ProvisioningValidatingWebhookPath, admission.ValidatingWebhookFor(prov))
+}
+
+// ValidateCreate implements admission.Validator
+func (prov *Provisioning) ValidateCreate() error {
+	return prov.ValidateBaremetalProvisioningConfig()
+}
+
+// ValidateUpdate implements admission.Validator. Updates leaving the spec
+// unchanged, such as those of the finalizers, are always allowed, so that
+// a CR created while the webhook was not running can still be deleted.
+func (prov *Provisioning) ValidateUpdate(old runtime.Object) error {
+	oldProv, ok := old.(*Provisioning)
+	if !ok {
+		return fmt.Errorf("expected a Provisioning but got a %T", old)
+	}
+	if equality.Semantic.DeepEqual(prov.Spec, oldProv.Spec) {
+		return nil
+	}
+	return prov.ValidateBaremetalProvisioningConfigUpdate(&oldProv.Spec)
+}
+
+// ValidateDelete implements admission.Validator
+func (prov *Provisioning) ValidateDelete() error {
+	return nil
+}
@@ -0,0 +1,164 @@
+package provisioning
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// The Secrets holding the credentials of the clients of the Ironic
+	// and Ironic Inspector APIs, which require HTTP basic auth
+	baremetalIronicSecretName          = "metal3-ironic-password"
+	baremetalIronicInspectorSecretName = "metal3-ironic-inspector-password"
+	baremetalUsernameKey               = "username"
+	ironicUsername                     = "ironic-user"
+	ironicInspectorUsername            = "inspector-user"
+
+	// ironicPasswordLength is the length of the generated API passwords,
+	// which unlike the MariaDB password is not configurable
+	ironicPasswordLength = 32
+
+	// The htpasswd files are generated within the pod, as Ironic only
+	// accepts bcrypt hashes
+	baremetalAuthVolume        = "metal3-auth"
+	baremetalAuthDir           = "/auth"
+	ironicAuthSubPath          = "ironic"
+	ironicInspectorAuthSubPath = "ironic-inspector"
+
+	// Where the metal3-baremetal-operator container looks for the
+	// username and password of each API
+	baremetalOperatorAuthDir = "/opt/metal3/auth"
+)
+
+// htpasswdGeneratorScript writes an htpasswd file for the Ironic and Ironic
+// Inspector APIs from the credentials in the environment.
+const htpasswdGeneratorScript = `set -e
+mkdir -p /auth/ironic /auth/ironic-inspector
+htpasswd -cbB /auth/ironic/htpasswd "${IRONIC_USERNAME}" "${IRONIC_PASSWORD}"
+htpasswd -cbB /auth/ironic-inspector/htpasswd "${IRONIC_INSPECTOR_USERNAME}" "${IRONIC_INSPECTOR_PASSWORD}"
+`
+
+func createIronicCredentialsSecret(config *OperatorConfig, name string, username string, ownerReferences []metav1.OwnerReference) (*corev1.Secret, error) {
+	password, err := generateRandomPassword(ironicPasswordLength)
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       config.TargetNamespace,
+			OwnerReferences: ownerReferences,
+		},
+		StringData: map[string]string{
+			baremetalUsernameKey: username,
+			baremetalSecretKey:   password,
+		},
+	}, nil
+}
+
+// getPasswordLength returns the length of the passwords generated for the
+// Secret called secretName.
+func getPasswordLength(config *OperatorConfig, secretName string) int {
+	if secretName == baremetalSecretName {
+		return config.MariadbPasswordLength
+	}
+	return ironicPasswordLength
+}
+
+func buildEnvVarFromSecret(name string, secretName string, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: secretName,
+				},
+				Key: key,
+			},
+		},
+	}
+}
+
+// newHtpasswdVolume returns the volume the htpasswd files are generated in.
+func newHtpasswdVolume() corev1.Volume {
+	return corev1.Volume{
+		Name: baremetalAuthVolume,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+}
+
+// newBaremetalOperatorAuthVolumes returns the volumes holding the
+// credentials of the API clients.
+func newBaremetalOperatorAuthVolumes() []corev1.Volume {
+	return []corev1.Volume{
+		{
+			Name: baremetalIronicSecretName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: baremetalIronicSecretName,
+				},
+			},
+		},
+		{
+			Name: baremetalIronicInspectorSecretName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: baremetalIronicInspectorSecretName,
+				},
+			},
+		},
+	}
+}
+
+// newHtpasswdVolumeMount mounts the htpasswd file generated for one of the
+// APIs, found in subPath of the auth volume, where the OS_DEFAULT__
+// HTTP_BASIC_AUTH_USER_FILE variable points to.
+func newHtpasswdVolumeMount(subPath string) corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      baremetalAuthVolume,
+		MountPath: baremetalAuthDir,
+		SubPath:   subPath,
+		ReadOnly:  true,
+	}
+}
+
+func createInitContainerHtpasswdGenerator(config *OperatorConfig) corev1.Container {
+	return corev1.Container{
+		Name:            "metal3-htpasswd-generator",
+		Image:           config.BaremetalControllers.Ironic,
+		Command:         []string{"/bin/sh", "-c", htpasswdGeneratorScript},
+		ImagePullPolicy: "IfNotPresent",
+		SecurityContext: newSecurityContext(),
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      baremetalAuthVolume,
+				MountPath: baremetalAuthDir,
+			},
+		},
+		Env: []corev1.EnvVar{
+			buildEnvVarFromSecret("IRONIC_USERNAME", baremetalIronicSecretName, baremetalUsernameKey),
+			buildEnvVarFromSecret("IRONIC_PASSWORD", baremetalIronicSecretName, baremetalSecretKey),
+			buildEnvVarFromSecret("IRONIC_INSPECTOR_USERNAME", baremetalIronicInspectorSecretName, baremetalUsernameKey),
+			buildEnvVarFromSecret("IRONIC_INSPECTOR_PASSWORD", baremetalIronicInspectorSecretName, baremetalSecretKey),
+		},
+	}
+}
+
+// newBaremetalOperatorAuthVolumeMounts mounts the credentials of each API
+// where the baremetal-operator reads them from.
+func newBaremetalOperatorAuthVolumeMounts() []corev1.VolumeMount {
+	return []corev1.VolumeMount{
+		{
+			Name:      baremetalIronicSecretName,
+			MountPath: baremetalOperatorAuthDir + "/ironic",
+			ReadOnly:  true,
+		},
+		{
+			Name:      baremetalIronicInspectorSecretName,
+			MountPath: baremetalOperatorAuthDir + "/ironic-inspector",
+			ReadOnly:  true,
+		},
+	}
+}
@@ -2,7 +2,13 @@ package provisioning
 
 import (
 	"fmt"
+	"math/big"
 	"net"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	metal3v1alpha1 "github.com/openshift/cluster-baremetal-operator/pkg/apis/metal3/v1alpha1"
 )
@@ -10,46 +16,99 @@ import (
 const (
 	baremetalProvisioningCR        = "provisioning-configuration"
 	baremetalHttpPort              = "6180"
+	baremetalVmediaHttpsPort       = "6183"
 	baremetalIronicPort            = "6385"
 	baremetalIronicInspectorPort   = "5050"
 	baremetalKernelUrlSubPath      = "images/ironic-python-agent.kernel"
 	baremetalRamdiskUrlSubPath     = "images/ironic-python-agent.initramfs"
 	baremetalIronicEndpointSubpath = "v1/"
+	// The default DHCP range goes from .10 to .100 of the provisioning
+	// network, as documented on ProvisioningDHCPRange
+	baremetalDefaultDHCPRangeStart = 10
+	baremetalDefaultDHCPRangeEnd   = 100
+	// Ironic boot interfaces for networks booted over PXE and for
+	// deployments through virtual media only
+	baremetalPXEBootInterface          = "ipxe"
+	baremetalVirtualMediaBootInterface = "redfish-virtual-media"
+	// The Ironic and Ironic Inspector APIs require HTTP basic auth
+	baremetalHttpBasicAuth = "http_basic"
 )
 
 // Provisioning Config needed to deploy Metal3 pod
 type BaremetalProvisioningConfig struct {
-	ProvisioningInterface     string
-	ProvisioningIp            string
-	ProvisioningNetworkCIDR   string
-	ProvisioningDHCPExternal  bool
-	ProvisioningDHCPRange     string
-	ProvisioningOSDownloadURL string
+	ProvisioningInterface            string
+	ProvisioningIp                   string
+	ProvisioningNetworkCIDR          string
+	ProvisioningDHCPExternal         bool
+	ProvisioningDHCPRange            string
+	ProvisioningOSDownloadURL        string
+	ProvisioningSecondaryIp          string
+	ProvisioningSecondaryNetworkCIDR string
+	ProvisioningSecondaryDHCPRange   string
+	ProvisioningIPv6AddressMode      metal3v1alpha1.IPv6AddressMode
+	ProvisioningNetwork              metal3v1alpha1.ProvisioningNetwork
+	VirtualMediaViaExternalNetwork   bool
+	WorkloadLayout                   metal3v1alpha1.WorkloadLayout
+	Storage                          *metal3v1alpha1.ProvisioningStorage
+	ContainerResources               []metal3v1alpha1.ContainerResources
+	ManageHostFirewall               bool
+	// ExternalHttpURL is where BMCs on the external network download
+	// virtual media images from. It is not part of the Provisioning CR,
+	// but assigned to the image endpoint Route by the router.
+	ExternalHttpURL string
+	// HTTPProxy, HTTPSProxy and NoProxy are read from the cluster-wide
+	// Proxy, and are empty when the cluster does not use a proxy.
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
 }
 
 func getBaremetalProvisioningConfig(cr *metal3v1alpha1.Provisioning) BaremetalProvisioningConfig {
 	return BaremetalProvisioningConfig{
-		ProvisioningInterface:     cr.Spec.ProvisioningInterface,
-		ProvisioningIp:            cr.Spec.ProvisioningIP,
-		ProvisioningNetworkCIDR:   cr.Spec.ProvisioningNetworkCIDR,
-		ProvisioningDHCPExternal:  cr.Spec.ProvisioningDHCPExternal,
-		ProvisioningDHCPRange:     cr.Spec.ProvisioningDHCPRange,
-		ProvisioningOSDownloadURL: cr.Spec.ProvisioningOSDownloadURL,
+		ProvisioningInterface:            cr.Spec.ProvisioningInterface,
+		ProvisioningIp:                   cr.Spec.ProvisioningIP,
+		ProvisioningNetworkCIDR:          cr.Spec.ProvisioningNetworkCIDR,
+		ProvisioningDHCPExternal:         cr.Spec.ProvisioningDHCPExternal,
+		ProvisioningDHCPRange:            cr.Spec.ProvisioningDHCPRange,
+		ProvisioningOSDownloadURL:        cr.Spec.ProvisioningOSDownloadURL,
+		ProvisioningSecondaryIp:          cr.Spec.ProvisioningSecondaryIP,
+		ProvisioningSecondaryNetworkCIDR: cr.Spec.ProvisioningSecondaryNetworkCIDR,
+		ProvisioningSecondaryDHCPRange:   cr.Spec.ProvisioningSecondaryDHCPRange,
+		ProvisioningIPv6AddressMode:      cr.Spec.ProvisioningIPv6AddressMode,
+		ProvisioningNetwork:              cr.Spec.ProvisioningNetworkMode(),
+		VirtualMediaViaExternalNetwork:   cr.Spec.VirtualMediaViaExternalNetwork,
+		WorkloadLayout:                   cr.Spec.WorkloadLayout,
+		Storage:                          cr.Spec.Storage,
+		ContainerResources:               cr.Spec.ContainerResources,
+		ManageHostFirewall:               cr.Spec.ManageHostFirewall,
 	}
 }
 
-func getProvisioningIPCIDR(baremetalConfig BaremetalProvisioningConfig) *string {
-	if baremetalConfig.ProvisioningNetworkCIDR != "" && baremetalConfig.ProvisioningIp != "" {
-		_, net, err := net.ParseCIDR(baremetalConfig.ProvisioningNetworkCIDR)
+// isDualStack reports whether the provisioning network has a second IP family
+func isDualStack(baremetalConfig BaremetalProvisioningConfig) bool {
+	return baremetalConfig.ProvisioningSecondaryIp != "" && baremetalConfig.ProvisioningSecondaryNetworkCIDR != ""
+}
+
+func getIPCIDR(ip string, networkCIDR string) *string {
+	if networkCIDR != "" && ip != "" {
+		_, net, err := net.ParseCIDR(networkCIDR)
 		if err == nil {
 			cidr, _ := net.Mask.Size()
-			generatedConfig := fmt.Sprintf("%s/%d", baremetalConfig.ProvisioningIp, cidr)
+			generatedConfig := fmt.Sprintf("%s/%d", ip, cidr)
 			return &generatedConfig
 		}
 	}
 	return nil
 }
 
+func getProvisioningIPCIDR(baremetalConfig BaremetalProvisioningConfig) *string {
+	return getIPCIDR(baremetalConfig.ProvisioningIp, baremetalConfig.ProvisioningNetworkCIDR)
+}
+
+func getProvisioningSecondaryIPCIDR(baremetalConfig BaremetalProvisioningConfig) *string {
+	return getIPCIDR(baremetalConfig.ProvisioningSecondaryIp, baremetalConfig.ProvisioningSecondaryNetworkCIDR)
+}
+
 func getDeployKernelUrl(baremetalConfig BaremetalProvisioningConfig) *string {
 	if baremetalConfig.ProvisioningIp != "" {
 		generatedConfig := fmt.Sprintf("http://%s/%s", net.JoinHostPort(baremetalConfig.ProvisioningIp, baremetalHttpPort), baremetalKernelUrlSubPath)
@@ -68,7 +127,7 @@ func getDeployRamdiskUrl(baremetalConfig BaremetalProvisioningConfig) *string {
 
 func getIronicEndpoint(baremetalConfig BaremetalProvisioningConfig) *string {
 	if baremetalConfig.ProvisioningIp != "" {
-		generatedConfig := fmt.Sprintf("http://%s/%s", net.JoinHostPort(baremetalConfig.ProvisioningIp, baremetalIronicPort), baremetalIronicEndpointSubpath)
+		generatedConfig := fmt.Sprintf("https://%s/%s", net.JoinHostPort(baremetalConfig.ProvisioningIp, baremetalIronicPort), baremetalIronicEndpointSubpath)
 		return &generatedConfig
 	}
 	return nil
@@ -76,7 +135,7 @@ func getIronicEndpoint(baremetalConfig BaremetalProvisioningConfig) *string {
 
 func getIronicInspectorEndpoint(baremetalConfig BaremetalProvisioningConfig) *string {
 	if baremetalConfig.ProvisioningIp != "" {
-		generatedConfig := fmt.Sprintf("http://%s/%s", net.JoinHostPort(baremetalConfig.ProvisioningIp, baremetalIronicInspectorPort), baremetalIronicEndpointSubpath)
+		generatedConfig := fmt.Sprintf("https://%s/%s", net.JoinHostPort(baremetalConfig.ProvisioningIp, baremetalIronicInspectorPort), baremetalIronicEndpointSubpath)
 		return &generatedConfig
 	}
 	return nil
@@ -85,12 +144,126 @@ func getIronicInspectorEndpoint(baremetalConfig BaremetalProvisioningConfig) *st
 func getProvisioningDHCPRange(baremetalConfig BaremetalProvisioningConfig) *string {
 	// When the DHCP server is external, it is OK for the DHCP range in the CR
 	// to be empty.
-	if baremetalConfig.ProvisioningDHCPRange != "" {
-		return &(baremetalConfig.ProvisioningDHCPRange)
-	} else if baremetalConfig.ProvisioningDHCPExternal {
+	if baremetalConfig.ProvisioningNetwork != metal3v1alpha1.ProvisioningNetworkManaged {
 		return &(baremetalConfig.ProvisioningDHCPRange)
 	}
-	return nil
+	return getDnsmasqDHCPRange(baremetalConfig.ProvisioningIp, baremetalConfig.ProvisioningNetworkCIDR,
+		baremetalConfig.ProvisioningDHCPRange, baremetalConfig.ProvisioningIPv6AddressMode)
+}
+
+func getProvisioningSecondaryDHCPRange(baremetalConfig BaremetalProvisioningConfig) *string {
+	if baremetalConfig.ProvisioningNetwork != metal3v1alpha1.ProvisioningNetworkManaged {
+		return &(baremetalConfig.ProvisioningSecondaryDHCPRange)
+	}
+	return getDnsmasqDHCPRange(baremetalConfig.ProvisioningSecondaryIp, baremetalConfig.ProvisioningSecondaryNetworkCIDR,
+		baremetalConfig.ProvisioningSecondaryDHCPRange, baremetalConfig.ProvisioningIPv6AddressMode)
+}
+
+// getEffectiveDHCPRange returns the range of addresses handed out by the
+// internal DHCP server, which is either the configured range or the
+// default one. IPv6 networks only hand out addresses in stateful DHCPv6
+// mode.
+func getEffectiveDHCPRange(ip string, networkCIDR string, dhcpRange string, mode metal3v1alpha1.IPv6AddressMode) *string {
+	_, ipNet, err := net.ParseCIDR(networkCIDR)
+	if err != nil {
+		return nil
+	}
+	if ipNet.IP.To4() == nil && mode != "" && mode != metal3v1alpha1.IPv6AddressModeDHCPv6Stateful {
+		return nil
+	}
+	if dhcpRange != "" {
+		return &dhcpRange
+	}
+	return getDefaultDHCPRange(ip, ipNet)
+}
+
+// getDnsmasqDHCPRange renders the range in the form expected by the
+// dhcp-range option of dnsmasq, as the start and end addresses separated
+// by a comma for both IP families. IPv6 ranges also carry the prefix
+// length of the network, and are replaced by a router advertisement mode
+// unless addresses are handed out by stateful DHCPv6.
+func getDnsmasqDHCPRange(ip string, networkCIDR string, dhcpRange string, mode metal3v1alpha1.IPv6AddressMode) *string {
+	_, ipNet, err := net.ParseCIDR(networkCIDR)
+	if err != nil {
+		return nil
+	}
+	prefixLen, _ := ipNet.Mask.Size()
+	var generatedConfig string
+	switch {
+	case ipNet.IP.To4() == nil && mode == metal3v1alpha1.IPv6AddressModeDHCPv6Stateless:
+		generatedConfig = fmt.Sprintf("%s,ra-stateless,%d", ipNet.IP, prefixLen)
+	case ipNet.IP.To4() == nil && mode == metal3v1alpha1.IPv6AddressModeSLAAC:
+		generatedConfig = fmt.Sprintf("%s,ra-only,%d", ipNet.IP, prefixLen)
+	default:
+		effectiveRange := getEffectiveDHCPRange(ip, networkCIDR, dhcpRange, mode)
+		if effectiveRange == nil {
+			return nil
+		}
+		generatedConfig = strings.Replace(*effectiveRange, " ", "", -1)
+		if ipNet.IP.To4() == nil {
+			generatedConfig = fmt.Sprintf("%s,%d", generatedConfig, prefixLen)
+		}
+	}
+	return &generatedConfig
+}
+
+// getDefaultDHCPRange computes the range from .10 to .100 of the
+// provisioning network. Networks too small for that range use all of
+// their usable addresses instead, and the provisioning IP is always left
+// out of the range.
+func getDefaultDHCPRange(provisioningIP string, ipNet *net.IPNet) *string {
+	ones, bits := ipNet.Mask.Size()
+	network := new(big.Int).SetBytes(ipNet.IP)
+
+	// Offsets of the usable addresses within the network. The network
+	// address is never handed out, and neither is the IPv4 broadcast.
+	first := big.NewInt(1)
+	last := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	last.Sub(last, big.NewInt(1))
+	if bits == 8*net.IPv4len {
+		last.Sub(last, big.NewInt(1))
+	}
+
+	start := big.NewInt(baremetalDefaultDHCPRangeStart)
+	end := big.NewInt(baremetalDefaultDHCPRangeEnd)
+	if start.Cmp(last) > 0 {
+		start = first
+	}
+	if end.Cmp(last) > 0 {
+		end = last
+	}
+
+	// Keep the provisioning IP out of the range by using the larger part
+	// of the range on either side of it.
+	if ip := net.ParseIP(provisioningIP); ip != nil && ipNet.Contains(ip) {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		offset := new(big.Int).Sub(new(big.Int).SetBytes(ip), network)
+		if offset.Cmp(start) >= 0 && offset.Cmp(end) <= 0 {
+			below := new(big.Int).Sub(offset, start)
+			above := new(big.Int).Sub(end, offset)
+			if above.Cmp(below) >= 0 {
+				start = new(big.Int).Add(offset, big.NewInt(1))
+			} else {
+				end = new(big.Int).Sub(offset, big.NewInt(1))
+			}
+		}
+	}
+
+	if start.Cmp(end) > 0 {
+		return nil
+	}
+	generatedConfig := fmt.Sprintf("%s,%s", ipAtOffset(ipNet, start), ipAtOffset(ipNet, end))
+	return &generatedConfig
+}
+
+// ipAtOffset returns the address offset addresses into ipNet.
+func ipAtOffset(ipNet *net.IPNet, offset *big.Int) net.IP {
+	value := new(big.Int).Add(new(big.Int).SetBytes(ipNet.IP), offset).Bytes()
+	ip := make(net.IP, len(ipNet.IP))
+	copy(ip[len(ip)-len(value):], value)
+	return ip
 }
 
 func getProvisioningInterface(baremetalConfig BaremetalProvisioningConfig) *string {
@@ -107,11 +280,61 @@ func getProvisioningOSDownloadURL(baremetalConfig BaremetalProvisioningConfig) *
 	return nil
 }
 
+// getIronicDefaultBootInterface returns the boot interface used by Ironic
+// for hosts that do not select one. Without a provisioning network hosts
+// cannot be booted over PXE, so virtual media is used instead.
+func getIronicDefaultBootInterface(baremetalConfig BaremetalProvisioningConfig) *string {
+	bootInterface := baremetalPXEBootInterface
+	if baremetalConfig.ProvisioningNetwork == metal3v1alpha1.ProvisioningNetworkDisabled {
+		bootInterface = baremetalVirtualMediaBootInterface
+	}
+	return &bootInterface
+}
+
+// getIronicEnabledBootInterfaces returns the boot interfaces Ironic may use.
+// PXE boot interfaces are only enabled when there is a provisioning network.
+func getIronicEnabledBootInterfaces(baremetalConfig BaremetalProvisioningConfig) *string {
+	bootInterfaces := []string{baremetalVirtualMediaBootInterface}
+	if baremetalConfig.ProvisioningNetwork != metal3v1alpha1.ProvisioningNetworkDisabled {
+		bootInterfaces = []string{baremetalPXEBootInterface, "pxe", baremetalVirtualMediaBootInterface}
+	}
+	generatedConfig := strings.Join(bootInterfaces, ",")
+	return &generatedConfig
+}
+
+func getExternalHttpURLConfig(baremetalConfig BaremetalProvisioningConfig) *string {
+	if baremetalConfig.VirtualMediaViaExternalNetwork && baremetalConfig.ExternalHttpURL != "" {
+		return &(baremetalConfig.ExternalHttpURL)
+	}
+	return nil
+}
+
+// getCertificateFile returns the path of the certificate or key that the
+// environment variable name points the containers to.
+func getCertificateFile(name string) *string {
+	files := map[string]string{
+		"IRONIC_CERT_FILE":           path.Join(ironicCertDir, corev1.TLSCertKey),
+		"IRONIC_KEY_FILE":            path.Join(ironicCertDir, corev1.TLSPrivateKeyKey),
+		"IRONIC_INSPECTOR_CERT_FILE": path.Join(ironicInspectorCertDir, corev1.TLSCertKey),
+		"IRONIC_INSPECTOR_KEY_FILE":  path.Join(ironicInspectorCertDir, corev1.TLSPrivateKeyKey),
+		"IRONIC_VMEDIA_CERT_FILE":    path.Join(ironicVmediaCertDir, corev1.TLSCertKey),
+		"IRONIC_VMEDIA_KEY_FILE":     path.Join(ironicVmediaCertDir, corev1.TLSPrivateKeyKey),
+		"IRONIC_CACERT_FILE":         path.Join(ironicCACertDir, baremetalCACertKey),
+	}
+	file, ok := files[name]
+	if !ok {
+		return nil
+	}
+	return &file
+}
+
 func getMetal3DeploymentConfig(name string, baremetalConfig BaremetalProvisioningConfig) *string {
 	configValue := ""
 	switch name {
 	case "PROVISIONING_IP":
 		return getProvisioningIPCIDR(baremetalConfig)
+	case "PROVISIONING_SECONDARY_IP":
+		return getProvisioningSecondaryIPCIDR(baremetalConfig)
 	case "PROVISIONING_INTERFACE":
 		return getProvisioningInterface(baremetalConfig)
 	case "DEPLOY_KERNEL_URL":
@@ -125,10 +348,123 @@ func getMetal3DeploymentConfig(name string, baremetalConfig BaremetalProvisionin
 	case "HTTP_PORT":
 		configValue = baremetalHttpPort
 		return &configValue
+	case "VMEDIA_TLS_PORT":
+		configValue = baremetalVmediaHttpsPort
+		return &configValue
+	case "OS_DEFAULT__AUTH_STRATEGY", "OS_INSPECTOR__AUTH_TYPE", "OS_IRONIC__AUTH_TYPE":
+		configValue = baremetalHttpBasicAuth
+		return &configValue
+	case "OS_DEFAULT__HTTP_BASIC_AUTH_USER_FILE":
+		configValue = path.Join(baremetalAuthDir, "htpasswd")
+		return &configValue
+	case "IRONIC_CERT_FILE", "IRONIC_INSPECTOR_CERT_FILE", "IRONIC_VMEDIA_CERT_FILE",
+		"IRONIC_KEY_FILE", "IRONIC_INSPECTOR_KEY_FILE", "IRONIC_VMEDIA_KEY_FILE", "IRONIC_CACERT_FILE":
+		return getCertificateFile(name)
 	case "DHCP_RANGE":
 		return getProvisioningDHCPRange(baremetalConfig)
+	case "SECONDARY_DHCP_RANGE":
+		return getProvisioningSecondaryDHCPRange(baremetalConfig)
 	case "RHCOS_IMAGE_URL":
 		return getProvisioningOSDownloadURL(baremetalConfig)
+	case "OS_DEFAULT__DEFAULT_BOOT_INTERFACE":
+		return getIronicDefaultBootInterface(baremetalConfig)
+	case "OS_DEFAULT__ENABLED_BOOT_INTERFACES":
+		return getIronicEnabledBootInterfaces(baremetalConfig)
+	case "OS_DEPLOY__EXTERNAL_HTTP_URL":
+		return getExternalHttpURLConfig(baremetalConfig)
+	case "OS_REDFISH__USE_SWIFT":
+		// Virtual media ISOs are built from the IPA kernel and
+		// ramdisk and served by metal3-httpd, as there is no Swift
+		configValue = "false"
+		return &configValue
+	case "OS_API__HOST_IP", "OS_DEFAULT__LISTEN_ADDRESS":
+		return getListenAddress(baremetalConfig)
+	case "LISTEN_ALL_INTERFACES":
+		configValue = fmt.Sprintf("%t", getHttpdListenAddress(baremetalConfig) == nil)
+		return &configValue
+	case "FIREWALL_TCP_PORTS":
+		configValue = strings.Join(getFirewallTCPPorts(baremetalConfig), ",")
+		return &configValue
+	case "FIREWALL_IPV4_SOURCES":
+		configValue = strings.Join(getProvisioningCIDRs(baremetalConfig, false), ",")
+		return &configValue
+	case "FIREWALL_IPV6_SOURCES":
+		configValue = strings.Join(getProvisioningCIDRs(baremetalConfig, true), ",")
+		return &configValue
+	case "HTTP_PROXY":
+		return &(baremetalConfig.HTTPProxy)
+	case "HTTPS_PROXY":
+		return &(baremetalConfig.HTTPSProxy)
+	case "NO_PROXY":
+		return &(baremetalConfig.NoProxy)
 	}
 	return nil
 }
+
+// metal3ConfigKeys maps the environment variables of the metal3 containers
+// to the keys of the metal3-config ConfigMap holding their values.
+var metal3ConfigKeys = map[string]string{
+	"PROVISIONING_IP":           "provisioning_ip",
+	"PROVISIONING_SECONDARY_IP": "provisioning_secondary_ip",
+	"PROVISIONING_INTERFACE":    "provisioning_interface",
+	"DEPLOY_KERNEL_URL":         "deploy_kernel_url",
+	"DEPLOY_RAMDISK_URL":        "deploy_ramdisk_url",
+	"IRONIC_ENDPOINT":           "ironic_endpoint",
+	"IRONIC_INSPECTOR_ENDPOINT": "ironic_inspector_endpoint",
+	"HTTP_PORT":                 "http_port",
+	"VMEDIA_TLS_PORT":           "vmedia_tls_port",
+	"DHCP_RANGE":                "dhcp_range",
+	"SECONDARY_DHCP_RANGE":      "secondary_dhcp_range",
+	"RHCOS_IMAGE_URL":           "rhcos_image_url",
+	// Certificates mounted from the metal3-ironic-tls Secret
+	"IRONIC_CERT_FILE":           "ironic_cert_file",
+	"IRONIC_KEY_FILE":            "ironic_key_file",
+	"IRONIC_INSPECTOR_CERT_FILE": "ironic_inspector_cert_file",
+	"IRONIC_INSPECTOR_KEY_FILE":  "ironic_inspector_key_file",
+	"IRONIC_VMEDIA_CERT_FILE":    "ironic_vmedia_cert_file",
+	"IRONIC_VMEDIA_KEY_FILE":     "ironic_vmedia_key_file",
+	"IRONIC_CACERT_FILE":         "ironic_cacert_file",
+	// Ironic reads options from OS_<SECTION>__<OPTION> variables
+	"OS_DEFAULT__DEFAULT_BOOT_INTERFACE":    "default_boot_interface",
+	"OS_DEFAULT__ENABLED_BOOT_INTERFACES":   "enabled_boot_interfaces",
+	"OS_DEPLOY__EXTERNAL_HTTP_URL":          "external_http_url",
+	"OS_REDFISH__USE_SWIFT":                 "redfish_use_swift",
+	"OS_DEFAULT__AUTH_STRATEGY":             "auth_strategy",
+	"OS_DEFAULT__HTTP_BASIC_AUTH_USER_FILE": "http_basic_auth_user_file",
+	"OS_INSPECTOR__AUTH_TYPE":               "inspector_auth_type",
+	"OS_IRONIC__AUTH_TYPE":                  "ironic_auth_type",
+	// Addresses the Ironic, Ironic Inspector and httpd listeners bind to
+	"OS_API__HOST_IP":            "ironic_listen_address",
+	"OS_DEFAULT__LISTEN_ADDRESS": "ironic_inspector_listen_address",
+	"LISTEN_ALL_INTERFACES":      "listen_all_interfaces",
+	// Rules of the metal3-host-firewall container
+	"FIREWALL_TCP_PORTS":    "firewall_tcp_ports",
+	"FIREWALL_IPV4_SOURCES": "firewall_ipv4_sources",
+	"FIREWALL_IPV6_SOURCES": "firewall_ipv6_sources",
+	// Cluster-wide proxy used by the downloaders and Ironic
+	"HTTP_PROXY":  "http_proxy",
+	"HTTPS_PROXY": "https_proxy",
+	"NO_PROXY":    "no_proxy",
+}
+
+// newMetal3ConfigMap generates the metal3-config ConfigMap referenced by
+// the metal3 containers. Every key is always present, so that the
+// containers can start even when a value does not apply to the current
+// configuration.
+func newMetal3ConfigMap(config *OperatorConfig, baremetalConfig BaremetalProvisioningConfig) *corev1.ConfigMap {
+	data := map[string]string{}
+	for name, key := range metal3ConfigKeys {
+		data[key] = ""
+		if value := getMetal3DeploymentConfig(name, baremetalConfig); value != nil {
+			data[key] = *value
+		}
+	}
+
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      baremetalConfigmap,
+			Namespace: config.TargetNamespace,
+		},
+		Data: data,
+	}
+}
@@ -0,0 +1,200 @@
+package provisioning
+
+import (
+	"net"
+
+	corev1 "k8s.io/api/core/v1"
+
+	metal3v1alpha1 "github.com/openshift/cluster-baremetal-operator/pkg/apis/metal3/v1alpha1"
+)
+
+const (
+	baremetalDHCPPort   = 67
+	baremetalDHCPv6Port = 547
+	baremetalTFTPPort   = 69
+)
+
+// hostFirewallScript keeps the METAL3-INPUT chain of the host in front of
+// the INPUT chain until the container is stopped. The chain only lets
+// connections to the metal3 TCP ports through when they come from the
+// host itself or from the provisioning networks on the provisioning
+// interface. The jump is checked every minute, as the host may reload its
+// own rules. The IPv6 rules are left out on hosts with IPv6 disabled.
+const hostFirewallScript = `set -u
+commands=iptables
+if [ -e /proc/net/if_inet6 ] && ip6tables -S INPUT >/dev/null 2>&1; then
+  commands="iptables ip6tables"
+fi
+setup() {
+  $1 -N METAL3-INPUT 2>/dev/null || $1 -F METAL3-INPUT
+  $1 -A METAL3-INPUT -i lo -j RETURN
+  for source in $(echo "$2" | tr ',' ' '); do
+    $1 -A METAL3-INPUT -i "${PROVISIONING_INTERFACE}" -s "${source}" -j RETURN
+  done
+  $1 -A METAL3-INPUT -p tcp -m multiport --dports "${FIREWALL_TCP_PORTS}" -j DROP
+}
+jump() {
+  $1 -C INPUT -j METAL3-INPUT 2>/dev/null || $1 -I INPUT -j METAL3-INPUT
+}
+cleanup() {
+  for cmd in ${commands}; do
+    $cmd -D INPUT -j METAL3-INPUT 2>/dev/null
+    $cmd -F METAL3-INPUT 2>/dev/null
+    $cmd -X METAL3-INPUT 2>/dev/null
+  done
+  exit 0
+}
+trap cleanup TERM INT
+for cmd in ${commands}; do
+  sources="${FIREWALL_IPV4_SOURCES}"
+  if [ "${cmd}" = ip6tables ]; then
+    sources="${FIREWALL_IPV6_SOURCES}"
+  fi
+  setup "${cmd}" "${sources}" || exit 1
+done
+while true; do
+  for cmd in ${commands}; do
+    jump "${cmd}" || exit 1
+  done
+  sleep 60 &
+  wait $!
+done
+`
+
+// anyNetwork is reported for ports reachable from every network.
+var anyNetwork = []string{"0.0.0.0/0", "::/0"}
+
+// getListenAddress returns the address Ironic and Ironic Inspector bind
+// to. They listen on the provisioning IP when there is a provisioning
+// network, and on every address otherwise. Both only bind to a single
+// address, so they also listen on every address on dual-stack networks.
+func getListenAddress(baremetalConfig BaremetalProvisioningConfig) *string {
+	if baremetalConfig.ProvisioningNetwork == metal3v1alpha1.ProvisioningNetworkDisabled ||
+		baremetalConfig.ProvisioningIp == "" || isDualStack(baremetalConfig) {
+		return nil
+	}
+	return &(baremetalConfig.ProvisioningIp)
+}
+
+// getHttpdListenAddress returns the address httpd binds to, which is the
+// one of Ironic unless BMCs download virtual media images through the
+// image endpoint Route.
+func getHttpdListenAddress(baremetalConfig BaremetalProvisioningConfig) *string {
+	if baremetalConfig.VirtualMediaViaExternalNetwork {
+		return nil
+	}
+	return getListenAddress(baremetalConfig)
+}
+
+// hasHostFirewall reports whether the metal3-host-firewall container
+// restricts access to the metal3 ports.
+func hasHostFirewall(baremetalConfig BaremetalProvisioningConfig) bool {
+	return baremetalConfig.ManageHostFirewall && baremetalConfig.ProvisioningNetwork != metal3v1alpha1.ProvisioningNetworkDisabled
+}
+
+// getFirewallTCPPorts returns the ports closed by the host firewall to
+// connections from outside the provisioning networks.
+func getFirewallTCPPorts(baremetalConfig BaremetalProvisioningConfig) []string {
+	ports := []string{baremetalIronicPort, baremetalIronicInspectorPort}
+	if !baremetalConfig.VirtualMediaViaExternalNetwork {
+		ports = append(ports, baremetalHttpPort, baremetalVmediaHttpsPort)
+	}
+	return ports
+}
+
+// getProvisioningCIDRs returns the provisioning networks of the IPv6 or
+// IPv4 family.
+func getProvisioningCIDRs(baremetalConfig BaremetalProvisioningConfig, ipv6 bool) []string {
+	cidrs := []string{}
+	if baremetalConfig.ProvisioningNetwork == metal3v1alpha1.ProvisioningNetworkDisabled {
+		return cidrs
+	}
+	for _, cidr := range []string{baremetalConfig.ProvisioningNetworkCIDR, baremetalConfig.ProvisioningSecondaryNetworkCIDR} {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		if (ipNet.IP.To4() == nil) == ipv6 {
+			cidrs = append(cidrs, ipNet.String())
+		}
+	}
+	return cidrs
+}
+
+func createContainerMetal3HostFirewall(config *OperatorConfig, baremetalProvisioningConfig BaremetalProvisioningConfig) corev1.Container {
+
+	// The Ironic Inspector image ships iptables for its PXE filter
+	container := corev1.Container{
+		Name:            "metal3-host-firewall",
+		Image:           config.BaremetalControllers.IronicInspector,
+		ImagePullPolicy: "IfNotPresent",
+		SecurityContext: newSecurityContext(networkAdminCapabilities...),
+		Command:         []string{"/bin/sh", "-c", hostFirewallScript},
+		Env: []corev1.EnvVar{
+			buildEnvVar("PROVISIONING_INTERFACE"),
+			buildEnvVar("FIREWALL_TCP_PORTS"),
+			buildEnvVar("FIREWALL_IPV4_SOURCES"),
+			buildEnvVar("FIREWALL_IPV6_SOURCES"),
+		},
+	}
+	return container
+}
+
+// getExposedPorts describes the ports the metal3 pod listens on. Ports
+// closed by the host firewall, and the DHCP and TFTP ports which dnsmasq
+// binds to the provisioning interface, are reachable from the
+// provisioning networks. Other ports are reported as reachable from
+// anywhere, as the provisioning network may be routed.
+func getExposedPorts(baremetalConfig BaremetalProvisioningConfig) []metal3v1alpha1.ExposedPort {
+	provisioningCIDRs := append(getProvisioningCIDRs(baremetalConfig, false), getProvisioningCIDRs(baremetalConfig, true)...)
+	firewalled := map[string]bool{}
+	if hasHostFirewall(baremetalConfig) {
+		for _, port := range getFirewallTCPPorts(baremetalConfig) {
+			firewalled[port] = true
+		}
+	}
+
+	newTCPPort := func(name string, port string, listenAddress *string) metal3v1alpha1.ExposedPort {
+		exposedPort := metal3v1alpha1.ExposedPort{
+			Name:          name,
+			Port:          parsePort(port),
+			Protocol:      corev1.ProtocolTCP,
+			ReachableFrom: append([]string{}, anyNetwork...),
+		}
+		if listenAddress != nil {
+			exposedPort.Interface = baremetalConfig.ProvisioningInterface
+			exposedPort.ListenAddress = *listenAddress
+		}
+		if firewalled[port] {
+			exposedPort.ReachableFrom = provisioningCIDRs
+		}
+		return exposedPort
+	}
+	ports := []metal3v1alpha1.ExposedPort{
+		newTCPPort("ironic", baremetalIronicPort, getListenAddress(baremetalConfig)),
+		newTCPPort("ironic-inspector", baremetalIronicInspectorPort, getListenAddress(baremetalConfig)),
+		newTCPPort(baremetalHttpPortName, baremetalHttpPort, getHttpdListenAddress(baremetalConfig)),
+		newTCPPort("https", baremetalVmediaHttpsPort, getHttpdListenAddress(baremetalConfig)),
+	}
+
+	if baremetalConfig.ProvisioningNetwork != metal3v1alpha1.ProvisioningNetworkManaged {
+		return ports
+	}
+	newUDPPort := func(name string, port int32, cidrs []string) metal3v1alpha1.ExposedPort {
+		return metal3v1alpha1.ExposedPort{
+			Name:          name,
+			Port:          port,
+			Protocol:      corev1.ProtocolUDP,
+			Interface:     baremetalConfig.ProvisioningInterface,
+			ReachableFrom: cidrs,
+		}
+	}
+	if cidrs := getProvisioningCIDRs(baremetalConfig, false); len(cidrs) > 0 {
+		ports = append(ports, newUDPPort("dhcp", baremetalDHCPPort, cidrs))
+	}
+	if cidrs := getProvisioningCIDRs(baremetalConfig, true); len(cidrs) > 0 {
+		ports = append(ports, newUDPPort("dhcpv6", baremetalDHCPv6Port, cidrs))
+	}
+	ports = append(ports, newUDPPort("tftp", baremetalTFTPPort, provisioningCIDRs))
+	return ports
+}
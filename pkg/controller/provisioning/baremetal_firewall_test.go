@@ -0,0 +1,202 @@
+package provisioning
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	metal3v1alpha1 "github.com/openshift/cluster-baremetal-operator/pkg/apis/metal3/v1alpha1"
+)
+
+// containerEnv returns the environment of each container, resolved from
+// the metal3-config ConfigMap.
+func containerEnv(baremetalConfig BaremetalProvisioningConfig) map[string]map[string]string {
+	configMap := newMetal3ConfigMap(&OperatorConfig{}, baremetalConfig)
+	env := map[string]map[string]string{}
+	for _, container := range newMetal3Containers(&OperatorConfig{}, baremetalConfig) {
+		env[container.Name] = map[string]string{}
+		for _, envVar := range container.Env {
+			if envVar.ValueFrom != nil && envVar.ValueFrom.ConfigMapKeyRef != nil {
+				env[container.Name][envVar.Name] = configMap.Data[envVar.ValueFrom.ConfigMapKeyRef.Key]
+			}
+		}
+	}
+	return env
+}
+
+func TestListenAddresses(t *testing.T) {
+	tCases := []struct {
+		name                   string
+		mutate                 func(*metal3v1alpha1.ProvisioningSpec)
+		expectedListenAddress  string
+		expectedHttpdAllIfaces string
+	}{
+		{
+			name:                   "Managed",
+			expectedListenAddress:  "172.30.20.3",
+			expectedHttpdAllIfaces: "false",
+		},
+		{
+			name: "VirtualMediaViaExternalNetwork",
+			mutate: func(s *metal3v1alpha1.ProvisioningSpec) {
+				s.VirtualMediaViaExternalNetwork = true
+			},
+			expectedListenAddress:  "172.30.20.3",
+			expectedHttpdAllIfaces: "true",
+		},
+		{
+			name: "DualStack",
+			mutate: func(s *metal3v1alpha1.ProvisioningSpec) {
+				s.ProvisioningSecondaryIP = "fd00:1101::3"
+				s.ProvisioningSecondaryNetworkCIDR = "fd00:1101::/64"
+			},
+			expectedHttpdAllIfaces: "true",
+		},
+		{
+			name: "Disabled",
+			mutate: func(s *metal3v1alpha1.ProvisioningSpec) {
+				s.ProvisioningNetwork = metal3v1alpha1.ProvisioningNetworkDisabled
+			},
+			expectedHttpdAllIfaces: "true",
+		},
+	}
+
+	for _, tc := range tCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := provisioningCR.DeepCopy()
+			if tc.mutate != nil {
+				tc.mutate(&cr.Spec)
+			}
+			baremetalConfig := getBaremetalProvisioningConfig(cr)
+			env := containerEnv(baremetalConfig)
+
+			for container, name := range map[string]string{"metal3-ironic-api": "OS_API__HOST_IP", "metal3-ironic-inspector": "OS_DEFAULT__LISTEN_ADDRESS"} {
+				value, ok := env[container][name]
+				if tc.expectedListenAddress == "" {
+					if ok {
+						t.Errorf("Expected %s not to set %s, got %s", container, name, value)
+					}
+				} else if value != tc.expectedListenAddress {
+					t.Errorf("Expected %s to set %s=%s, got %q", container, name, tc.expectedListenAddress, value)
+				}
+			}
+			if actual := env["metal3-httpd"]["LISTEN_ALL_INTERFACES"]; actual != tc.expectedHttpdAllIfaces {
+				t.Errorf("Expected LISTEN_ALL_INTERFACES=%s, got %q", tc.expectedHttpdAllIfaces, actual)
+			}
+
+			// The kubelet probes the address the servers are bound to
+			for _, container := range newMetal3Containers(&OperatorConfig{}, baremetalConfig) {
+				if container.ReadinessProbe == nil || container.ReadinessProbe.HTTPGet == nil {
+					continue
+				}
+				expectedHost := tc.expectedListenAddress
+				if container.Name == "metal3-httpd" && tc.expectedHttpdAllIfaces == "true" {
+					expectedHost = ""
+				}
+				if host := container.ReadinessProbe.HTTPGet.Host; host != expectedHost {
+					t.Errorf("Expected %s to be probed at %q, got %q", container.Name, expectedHost, host)
+				}
+			}
+		})
+	}
+}
+
+func TestHostFirewallContainer(t *testing.T) {
+	cr := provisioningCR.DeepCopy()
+	if _, ok := containerEnv(getBaremetalProvisioningConfig(cr))["metal3-host-firewall"]; ok {
+		t.Errorf("Expected no firewall container unless manageHostFirewall is set")
+	}
+
+	cr.Spec.ManageHostFirewall = true
+	cr.Spec.ProvisioningSecondaryIP = "fd00:1101::3"
+	cr.Spec.ProvisioningSecondaryNetworkCIDR = "fd00:1101::/64"
+	env, ok := containerEnv(getBaremetalProvisioningConfig(cr))["metal3-host-firewall"]
+	if !ok {
+		t.Fatalf("Expected a firewall container")
+	}
+	expectedEnv := map[string]string{
+		"PROVISIONING_INTERFACE": "ensp0",
+		"FIREWALL_TCP_PORTS":     "6385,5050,6180,6183",
+		"FIREWALL_IPV4_SOURCES":  "172.30.20.0/24",
+		"FIREWALL_IPV6_SOURCES":  "fd00:1101::/64",
+	}
+	if !reflect.DeepEqual(env, expectedEnv) {
+		t.Errorf("Expected %v, got %v", expectedEnv, env)
+	}
+
+	cr.Spec.VirtualMediaViaExternalNetwork = true
+	env = containerEnv(getBaremetalProvisioningConfig(cr))["metal3-host-firewall"]
+	if actual := env["FIREWALL_TCP_PORTS"]; actual != "6385,5050" {
+		t.Errorf("Expected the httpd ports to be left open, got %s", actual)
+	}
+
+	// A firewall carried over from an earlier spec is not applied without
+	// a provisioning network
+	cr.Spec.ProvisioningNetwork = metal3v1alpha1.ProvisioningNetworkDisabled
+	if _, ok := containerEnv(getBaremetalProvisioningConfig(cr))["metal3-host-firewall"]; ok {
+		t.Errorf("Expected no firewall container without a provisioning network")
+	}
+}
+
+func TestGetExposedPorts(t *testing.T) {
+	provisioningNetwork := []string{"172.30.20.0/24"}
+
+	tCases := []struct {
+		name     string
+		mutate   func(*metal3v1alpha1.ProvisioningSpec)
+		expected []metal3v1alpha1.ExposedPort
+	}{
+		{
+			name: "Managed",
+			expected: []metal3v1alpha1.ExposedPort{
+				{Name: "ironic", Port: 6385, Protocol: corev1.ProtocolTCP, Interface: "ensp0", ListenAddress: "172.30.20.3", ReachableFrom: anyNetwork},
+				{Name: "ironic-inspector", Port: 5050, Protocol: corev1.ProtocolTCP, Interface: "ensp0", ListenAddress: "172.30.20.3", ReachableFrom: anyNetwork},
+				{Name: "http", Port: 6180, Protocol: corev1.ProtocolTCP, Interface: "ensp0", ListenAddress: "172.30.20.3", ReachableFrom: anyNetwork},
+				{Name: "https", Port: 6183, Protocol: corev1.ProtocolTCP, Interface: "ensp0", ListenAddress: "172.30.20.3", ReachableFrom: anyNetwork},
+				{Name: "dhcp", Port: 67, Protocol: corev1.ProtocolUDP, Interface: "ensp0", ReachableFrom: provisioningNetwork},
+				{Name: "tftp", Port: 69, Protocol: corev1.ProtocolUDP, Interface: "ensp0", ReachableFrom: provisioningNetwork},
+			},
+		},
+		{
+			name: "ManagedWithFirewall",
+			mutate: func(s *metal3v1alpha1.ProvisioningSpec) {
+				s.ManageHostFirewall = true
+				s.VirtualMediaViaExternalNetwork = true
+			},
+			expected: []metal3v1alpha1.ExposedPort{
+				{Name: "ironic", Port: 6385, Protocol: corev1.ProtocolTCP, Interface: "ensp0", ListenAddress: "172.30.20.3", ReachableFrom: provisioningNetwork},
+				{Name: "ironic-inspector", Port: 5050, Protocol: corev1.ProtocolTCP, Interface: "ensp0", ListenAddress: "172.30.20.3", ReachableFrom: provisioningNetwork},
+				{Name: "http", Port: 6180, Protocol: corev1.ProtocolTCP, ReachableFrom: anyNetwork},
+				{Name: "https", Port: 6183, Protocol: corev1.ProtocolTCP, ReachableFrom: anyNetwork},
+				{Name: "dhcp", Port: 67, Protocol: corev1.ProtocolUDP, Interface: "ensp0", ReachableFrom: provisioningNetwork},
+				{Name: "tftp", Port: 69, Protocol: corev1.ProtocolUDP, Interface: "ensp0", ReachableFrom: provisioningNetwork},
+			},
+		},
+		{
+			name: "Disabled",
+			mutate: func(s *metal3v1alpha1.ProvisioningSpec) {
+				s.ProvisioningNetwork = metal3v1alpha1.ProvisioningNetworkDisabled
+			},
+			expected: []metal3v1alpha1.ExposedPort{
+				{Name: "ironic", Port: 6385, Protocol: corev1.ProtocolTCP, ReachableFrom: anyNetwork},
+				{Name: "ironic-inspector", Port: 5050, Protocol: corev1.ProtocolTCP, ReachableFrom: anyNetwork},
+				{Name: "http", Port: 6180, Protocol: corev1.ProtocolTCP, ReachableFrom: anyNetwork},
+				{Name: "https", Port: 6183, Protocol: corev1.ProtocolTCP, ReachableFrom: anyNetwork},
+			},
+		},
+	}
+
+	for _, tc := range tCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := provisioningCR.DeepCopy()
+			if tc.mutate != nil {
+				tc.mutate(&cr.Spec)
+			}
+			actual := getExposedPorts(getBaremetalProvisioningConfig(cr))
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected %+v, got %+v", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package provisioning
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+)
+
+const (
+	// baremetalImageEndpoint names the Service and Route through which
+	// BMCs on the external network download virtual media images from
+	// the metal3-httpd container.
+	baremetalImageEndpoint = "metal3-image-endpoint"
+	baremetalHttpPortName  = "http"
+)
+
+func newMetal3ImageService(config *OperatorConfig) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      baremetalImageEndpoint,
+			Namespace: config.TargetNamespace,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: metal3AppLabels,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       baremetalHttpPortName,
+					Port:       80,
+					TargetPort: intstr.FromString(baremetalHttpPortName),
+				},
+			},
+		},
+	}
+}
+
+func newMetal3ImageRoute(config *OperatorConfig) *routev1.Route {
+	return &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      baremetalImageEndpoint,
+			Namespace: config.TargetNamespace,
+		},
+		Spec: routev1.RouteSpec{
+			To: routev1.RouteTargetReference{
+				Kind: "Service",
+				Name: baremetalImageEndpoint,
+			},
+			Port: &routev1.RoutePort{
+				TargetPort: intstr.FromString(baremetalHttpPortName),
+			},
+		},
+	}
+}
+
+// getExternalHttpURL returns the URL under which route serves the images
+// of the metal3-httpd container, or nil until the router has assigned a
+// host to it.
+func getExternalHttpURL(route *routev1.Route) *string {
+	if route.Spec.Host == "" {
+		return nil
+	}
+	generatedConfig := fmt.Sprintf("http://%s/", route.Spec.Host)
+	return &generatedConfig
+}
+
+// ensureImageEndpoint applies the Service and Route exposing the
+// metal3-httpd container outside of the cluster, and returns the URL the
+// Route is reachable at.
+func (r *ReconcileProvisioning) ensureImageEndpoint(ownerReferences []metav1.OwnerReference) (*string, error) {
+	service := newMetal3ImageService(r.config)
+	service.OwnerReferences = ownerReferences
+	_, _, err := resourceapply.ApplyService(r.coreClient, events.NewLoggingEventRecorder(componentName), service)
+	if err != nil {
+		return nil, err
+	}
+
+	route := newMetal3ImageRoute(r.config)
+	route.OwnerReferences = ownerReferences
+	existing := &routev1.Route{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: route.Name, Namespace: route.Namespace}, existing)
+	if errors.IsNotFound(err) {
+		err = r.client.Create(context.TODO(), route)
+		if err != nil {
+			return nil, err
+		}
+		return getExternalHttpURL(route), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// The host is generated by the router, so it is kept as it is
+	if !equality.Semantic.DeepEqual(existing.Spec.To, route.Spec.To) || !equality.Semantic.DeepEqual(existing.Spec.Port, route.Spec.Port) {
+		existing.Spec.To = route.Spec.To
+		existing.Spec.Port = route.Spec.Port
+		err = r.client.Update(context.TODO(), existing)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return getExternalHttpURL(existing), nil
+}
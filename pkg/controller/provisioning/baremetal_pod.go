@@ -1,29 +1,110 @@
 package provisioning
 
 import (
-	"math/rand"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/pointer"
+
+	metal3v1alpha1 "github.com/openshift/cluster-baremetal-operator/pkg/apis/metal3/v1alpha1"
 )
 
 const (
-	baremetalConfigmap    = "metal3-config"
-	baremetalSharedVolume = "metal3-shared"
-	baremetalSecretName   = "metal3-mariadb-password"
-	baremetalSecretKey    = "password"
+	baremetalDeploymentName = "metal3"
+	// baremetalOperatorDeploymentName runs the baremetal-operator in the
+	// Split workload layout
+	baremetalOperatorDeploymentName = "metal3-baremetal-operator"
+	baremetalConfigmap              = "metal3-config"
+	baremetalSharedVolume           = "metal3-shared"
+	baremetalSecretName             = "metal3-mariadb-password"
+	baremetalSecretKey              = "password"
+
+	// baremetalServiceAccountName runs the metal3 pods, which are
+	// admitted by the SecurityContextConstraints called
+	// baremetalSecurityContextConstraints
+	baremetalServiceAccountName         = "baremetal-controller"
+	baremetalSecurityContextConstraints = "metal3"
+
+	defaultMariadbPasswordLength = 16
+
+	// passwordRotateAnnotation requests a new password when set on one of
+	// the password Secrets, whatever its value.
+	passwordRotateAnnotation = "metal3.io/rotate-password"
+
+	// passwordRotatedAtAnnotation records when the password in a Secret
+	// was last rotated.
+	passwordRotatedAtAnnotation = "metal3.io/password-rotated-at"
+
+	// The prefixes of the metal3 pod template annotations holding the
+	// hash of the contents of each Secret and ConfigMap the pod consumes.
+	secretHashAnnotationPrefix    = "metal3.io/secret-hash-"
+	configMapHashAnnotationPrefix = "metal3.io/configmap-hash-"
+
+	// specHashAnnotation holds a hash of the spec of each Deployment, as
+	// resourceapply.ApplyDeployment only updates a Deployment whose
+	// metadata or generation changed.
+	specHashAnnotation = "metal3.io/spec-hash"
 )
 
-var volumes = []corev1.Volume{
-	{
-		Name: baremetalSharedVolume,
-		VolumeSource: corev1.VolumeSource{
-			EmptyDir: &corev1.EmptyDirVolumeSource{},
-		},
-	},
+// metal3PodSecrets and metal3PodConfigMaps are the names of the Secrets and
+// ConfigMaps consumed by the metal3 pod.
+var (
+	metal3PodSecrets    = []string{baremetalSecretName, baremetalIronicSecretName, baremetalIronicInspectorSecretName, baremetalTLSSecretName}
+	metal3PodConfigMaps = []string{baremetalConfigmap, baremetalTrustedCAConfigMap}
+)
+
+// mariadbStartScript starts MariaDB, and sets the password of the ironic
+// database user from the Secret once MariaDB accepts connections, as a
+// database kept from an earlier pod still holds the previous password.
+// Setting the password is retried in the background until it succeeds,
+// and the password is escaped rather than trusted to be alphanumeric.
+const mariadbStartScript = `sync_password() {
+  password=$(printf '%s' "${MARIADB_PASSWORD}" | sed -e 's/\\/\\\\/g' -e "s/'/''/g")
+  sql="ALTER USER IF EXISTS 'ironic'@'localhost' IDENTIFIED BY '${password}'; FLUSH PRIVILEGES;"
+  until mysqladmin --user=root ping --silent 2>/dev/null && printf '%s\n' "${sql}" | mysql --user=root; do
+    sleep 2
+  done
+}
+sync_password &
+exec /bin/runmariadb
+`
+
+// networkAdminCapabilities let the DHCP server and the static IP manager
+// configure the provisioning interface and send raw packets on it, and the
+// host firewall manage the iptables rules of the host.
+var networkAdminCapabilities = []corev1.Capability{"NET_ADMIN", "NET_RAW"}
+
+// newSecurityContext returns the security context of an unprivileged
+// metal3 container, which is granted capabilities on top of the defaults
+// of the container runtime. It may not escalate its privileges, as the
+// metal3 SecurityContextConstraints forbid it.
+func newSecurityContext(capabilities ...corev1.Capability) *corev1.SecurityContext {
+	securityContext := &corev1.SecurityContext{
+		Privileged:               pointer.BoolPtr(false),
+		AllowPrivilegeEscalation: pointer.BoolPtr(false),
+	}
+	if len(capabilities) > 0 {
+		securityContext.Capabilities = &corev1.Capabilities{
+			Add: capabilities,
+		}
+	}
+	return securityContext
+}
+
+// metal3AppLabels select the metal3 pod among the pods of the namespace,
+// which also holds machine-api controllers labeled like the metal3 pod.
+var metal3AppLabels = map[string]string{
+	"app": "metal3",
 }
 
 var volumeMounts = []corev1.VolumeMount{
@@ -33,6 +114,12 @@ var volumeMounts = []corev1.VolumeMount{
 	},
 }
 
+// metal3VolumeMounts returns the volume mounts shared by the metal3
+// containers along with extra ones.
+func metal3VolumeMounts(extra ...corev1.VolumeMount) []corev1.VolumeMount {
+	return append(append([]corev1.VolumeMount{}, volumeMounts...), extra...)
+}
+
 func buildEnvVarFromConfigMap(name string, key string) corev1.EnvVar {
 	return corev1.EnvVar{
 		Name: name,
@@ -47,86 +134,292 @@ func buildEnvVarFromConfigMap(name string, key string) corev1.EnvVar {
 	}
 }
 
-func buildEnvVar(name string, key string, baremetalProvisioningConfig BaremetalProvisioningConfig) corev1.EnvVar {
-	value := getMetal3DeploymentConfig(name, baremetalProvisioningConfig)
-	if value != nil {
-		return corev1.EnvVar{
-			Name:  name,
-			Value: *value,
-		}
-	} else {
-		return buildEnvVarFromConfigMap(name, key)
-	}
+// buildEnvVar returns the environment variable name, resolved from the
+// metal3-config ConfigMap generated by newMetal3ConfigMap.
+func buildEnvVar(name string) corev1.EnvVar {
+	return buildEnvVarFromConfigMap(name, metal3ConfigKeys[name])
 }
 
 func setMariadbPassword() corev1.EnvVar {
-	return corev1.EnvVar{
-		Name: "MARIADB_PASSWORD",
-		ValueFrom: &corev1.EnvVarSource{
-			SecretKeyRef: &corev1.SecretKeySelector{
-				LocalObjectReference: corev1.LocalObjectReference{
-					Name: baremetalSecretName,
-				},
-				Key: baremetalSecretKey,
-			},
-		},
-	}
+	return buildEnvVarFromSecret("MARIADB_PASSWORD", baremetalSecretName, baremetalSecretKey)
 }
 
-func generateRandomPassword() string {
-	rand.Seed(time.Now().UnixNano())
+// generateRandomPassword returns a random alphanumeric password of the
+// given length, drawn from crypto/rand.
+func generateRandomPassword(length int) (string, error) {
 	chars := []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
 		"abcdefghijklmnopqrstuvwxyz" +
 		"0123456789")
-	length := 16
+	max := big.NewInt(int64(len(chars)))
 	buf := make([]rune, length)
 	for i := range buf {
-		buf[i] = chars[rand.Intn(len(chars))]
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		buf[i] = chars[n.Int64()]
+	}
+	return string(buf), nil
+}
+
+// getMariadbPasswordLength parses the configured length of generated
+// MariaDB passwords, falling back to the default when it is not set or
+// shorter than the default.
+func getMariadbPasswordLength(value string) int {
+	if value == "" {
+		return defaultMariadbPasswordLength
+	}
+	length, err := strconv.Atoi(value)
+	if err != nil || length < defaultMariadbPasswordLength {
+		log.Info("Ignoring invalid MariaDB password length", "length", value, "default", defaultMariadbPasswordLength)
+		return defaultMariadbPasswordLength
 	}
-	return (string(buf))
+	return length
 }
 
-func createMariadbPasswordSecret(config *OperatorConfig) *corev1.Secret {
+func createMariadbPasswordSecret(config *OperatorConfig, ownerReferences []metav1.OwnerReference) (*corev1.Secret, error) {
+	password, err := generateRandomPassword(config.MariadbPasswordLength)
+	if err != nil {
+		return nil, err
+	}
 	return &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      baremetalSecretName,
-			Namespace: config.TargetNamespace,
+			Name:            baremetalSecretName,
+			Namespace:       config.TargetNamespace,
+			OwnerReferences: ownerReferences,
 		},
 		StringData: map[string]string{
-			baremetalSecretKey: generateRandomPassword(),
+			baremetalSecretKey: password,
 		},
+	}, nil
+}
+
+// rotatePassword replaces the password in the Secret when its rotation has
+// been requested, and records the time of the rotation. It returns whether
+// the Secret was changed.
+func rotatePassword(config *OperatorConfig, secret *corev1.Secret) (bool, error) {
+	if _, ok := secret.Annotations[passwordRotateAnnotation]; !ok {
+		return false, nil
+	}
+	password, err := generateRandomPassword(getPasswordLength(config, secret.Name))
+	if err != nil {
+		return false, err
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[baremetalSecretKey] = []byte(password)
+	delete(secret.Annotations, passwordRotateAnnotation)
+	secret.Annotations[passwordRotatedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	return true, nil
+}
+
+// contentHash returns a hash of data that does not depend on the order of
+// its keys.
+func contentHash(data map[string][]byte) string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%d:%s%d:", len(key), key, len(data[key]))
+		hash.Write(data[key])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
 }
 
-func newMetal3Deployment(config *OperatorConfig, baremetalProvisioningConfig BaremetalProvisioningConfig) *appsv1.Deployment {
+// setSpecHashAnnotation records the hash of the spec of deployment in its
+// annotations, so that any change to the spec is applied.
+func setSpecHashAnnotation(deployment *appsv1.Deployment) error {
+	spec, err := json.Marshal(deployment.Spec)
+	if err != nil {
+		return err
+	}
+	if deployment.Annotations == nil {
+		deployment.Annotations = map[string]string{}
+	}
+	deployment.Annotations[specHashAnnotation] = contentHash(map[string][]byte{"spec": spec})
+	return nil
+}
+
+// secretContentHash hashes the contents of secret, including StringData
+// not yet merged into Data by the API server.
+func secretContentHash(secret *corev1.Secret) string {
+	data := map[string][]byte{}
+	for key, value := range secret.Data {
+		data[key] = value
+	}
+	for key, value := range secret.StringData {
+		data[key] = []byte(value)
+	}
+	return contentHash(data)
+}
+
+func configMapContentHash(configMap *corev1.ConfigMap) string {
+	data := map[string][]byte{}
+	for key, value := range configMap.Data {
+		data[key] = []byte(value)
+	}
+	for key, value := range configMap.BinaryData {
+		data[key] = value
+	}
+	return contentHash(data)
+}
+
+// isSplitLayout reports whether the baremetal-operator runs in a
+// Deployment of its own.
+func isSplitLayout(baremetalProvisioningConfig BaremetalProvisioningConfig) bool {
+	return baremetalProvisioningConfig.WorkloadLayout == metal3v1alpha1.WorkloadLayoutSplit
+}
+
+// podSpecReferences returns the names of the Secrets and ConfigMaps
+// consumed by the pod, through volumes or environment variables.
+func podSpecReferences(podSpec *corev1.PodSpec) (secretNames, configMapNames map[string]bool) {
+	secretNames = map[string]bool{}
+	configMapNames = map[string]bool{}
+	for _, volume := range podSpec.Volumes {
+		if volume.Secret != nil {
+			secretNames[volume.Secret.SecretName] = true
+		}
+		if volume.ConfigMap != nil {
+			configMapNames[volume.ConfigMap.Name] = true
+		}
+	}
+	for _, container := range append(podSpec.InitContainers, podSpec.Containers...) {
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if env.ValueFrom.SecretKeyRef != nil {
+				secretNames[env.ValueFrom.SecretKeyRef.Name] = true
+			}
+			if env.ValueFrom.ConfigMapKeyRef != nil {
+				configMapNames[env.ValueFrom.ConfigMapKeyRef.Name] = true
+			}
+		}
+	}
+	return secretNames, configMapNames
+}
+
+// newPodAnnotations returns the annotations of a pod template, holding the
+// hash of each of configMap and secrets the pod consumes. Kubernetes does
+// not restart pods when those change, so a new pod is rolled out instead.
+// The others are left out, so that they do not restart the pod.
+func newPodAnnotations(podSpec *corev1.PodSpec, configMap *corev1.ConfigMap, secrets []*corev1.Secret) map[string]string {
+	secretNames, configMapNames := podSpecReferences(podSpec)
+	annotations := map[string]string{}
+	if configMapNames[configMap.Name] {
+		annotations[configMapHashAnnotationPrefix+configMap.Name] = configMapContentHash(configMap)
+	}
+	for _, secret := range secrets {
+		if secretNames[secret.Name] {
+			annotations[secretHashAnnotationPrefix+secret.Name] = secretContentHash(secret)
+		}
+	}
+	return annotations
+}
+
+// newDeployment returns a Deployment called name running a single replica
+// of template, whose labels must match selector.
+func newDeployment(config *OperatorConfig, name string, selector map[string]string, template *corev1.PodTemplateSpec) *appsv1.Deployment {
 	replicas := int32(1)
-	template := newMetal3PodTemplateSpec(config, baremetalProvisioningConfig)
+	labels := map[string]string{}
+	for key, value := range selector {
+		labels[key] = value
+	}
 
 	return &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "metal3",
+			Name:      name,
 			Namespace: config.TargetNamespace,
-			Labels: map[string]string{
-				"api":     "clusterapi",
-				"k8s-app": "controller",
-			},
+			Labels:    labels,
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: &replicas,
 			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"api":     "clusterapi",
-					"k8s-app": "controller",
-				},
+				MatchLabels: selector,
 			},
 			Template: *template,
 		},
 	}
 }
 
-func newMetal3PodTemplateSpec(config *OperatorConfig, baremetalProvisioningConfig BaremetalProvisioningConfig) *corev1.PodTemplateSpec {
-	initContainers := newMetal3InitContainers(config, baremetalProvisioningConfig)
-	containers := newMetal3Containers(config, baremetalProvisioningConfig)
+func newMetal3Deployment(config *OperatorConfig, baremetalProvisioningConfig BaremetalProvisioningConfig, secrets []*corev1.Secret) *appsv1.Deployment {
+	template := newMetal3PodTemplateSpec(config, baremetalProvisioningConfig, secrets)
+	deployment := newDeployment(config, baremetalDeploymentName, newMetal3PodLabels(), template)
+	if hasPersistentStorage(baremetalProvisioningConfig) {
+		// A new pod cannot attach the volumes before the old one has
+		// released them
+		deployment.Spec.Strategy = appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}
+	}
+	return deployment
+}
+
+// newMetal3PodLabels returns the labels of the metal3 pod, by which the
+// metal3 Deployment selects it.
+func newMetal3PodLabels() map[string]string {
+	return map[string]string{
+		"api":     "clusterapi",
+		"k8s-app": "controller",
+	}
+}
+
+// newBaremetalOperatorDeployment returns the Deployment running the
+// baremetal-operator in the Split workload layout. Its pods must not be
+// selected by the metal3 Deployment. They run on the node of the metal3
+// pod, as the provisioning IP Ironic is reached at is only configured
+// there, and the host firewall only lets local connections through. The
+// metal3 pod is told apart from the machine-api controllers by its app
+// label.
+func newBaremetalOperatorDeployment(config *OperatorConfig, baremetalProvisioningConfig BaremetalProvisioningConfig, secrets []*corev1.Secret) *appsv1.Deployment {
+	selector := map[string]string{
+		"api":     "clusterapi",
+		"k8s-app": baremetalOperatorDeploymentName,
+	}
+	podVolumes := append([]corev1.Volume{newCACertVolume()}, newBaremetalOperatorAuthVolumes()...)
+	containers := []corev1.Container{createContainerMetal3BaremetalOperator(config, baremetalProvisioningConfig)}
+	podSpec := newMetal3PodSpec(baremetalProvisioningConfig, podVolumes, nil, containers)
+	podSpec.Affinity = &corev1.Affinity{
+		PodAffinity: &corev1.PodAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+				{
+					LabelSelector: &metav1.LabelSelector{MatchLabels: metal3AppLabels},
+					TopologyKey:   "kubernetes.io/hostname",
+				},
+			},
+		},
+	}
+
+	template := &corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      selector,
+			Annotations: newPodAnnotations(&podSpec, newMetal3ConfigMap(config, baremetalProvisioningConfig), secrets),
+		},
+		Spec: podSpec,
+	}
+	return newDeployment(config, baremetalOperatorDeploymentName, selector, template)
+}
+
+func newMetal3Volumes(baremetalProvisioningConfig BaremetalProvisioningConfig) []corev1.Volume {
+	metal3Volumes := []corev1.Volume{newSharedVolume(baremetalProvisioningConfig), newServingCertVolume(), newCACertVolume(), newHtpasswdVolume()}
+	if hasPersistentStorage(baremetalProvisioningConfig) {
+		metal3Volumes = append(metal3Volumes, newDatabaseVolume())
+	}
+	if !isSplitLayout(baremetalProvisioningConfig) {
+		metal3Volumes = append(metal3Volumes, newBaremetalOperatorAuthVolumes()...)
+	}
+	if usesProxy(baremetalProvisioningConfig) {
+		metal3Volumes = append(metal3Volumes, newTrustedCAVolume())
+	}
+	return metal3Volumes
+}
+
+// newMetal3PodSpec returns the spec of a pod running metal3 components on
+// the host network of a master, with the resources of their containers.
+func newMetal3PodSpec(baremetalProvisioningConfig BaremetalProvisioningConfig, podVolumes []corev1.Volume, initContainers []corev1.Container, containers []corev1.Container) corev1.PodSpec {
 	tolerations := []corev1.Toleration{
 		{
 			Key:    "node-role.kubernetes.io/master",
@@ -150,26 +443,41 @@ func newMetal3PodTemplateSpec(config *OperatorConfig, baremetalProvisioningConfi
 		},
 	}
 
+	podSpec := corev1.PodSpec{
+		Volumes:            podVolumes,
+		InitContainers:     initContainers,
+		Containers:         containers,
+		HostNetwork:        true,
+		PriorityClassName:  "system-node-critical",
+		NodeSelector:       map[string]string{"node-role.kubernetes.io/master": ""},
+		ServiceAccountName: baremetalServiceAccountName,
+		Tolerations:        tolerations,
+	}
+	setContainerResources(&podSpec, baremetalProvisioningConfig.ContainerResources)
+	return podSpec
+}
+
+// newMetal3PodTemplateSpec returns the template of the metal3 pod. secrets
+// are the Secrets that may be consumed by the pod, listed in
+// metal3PodSecrets.
+func newMetal3PodTemplateSpec(config *OperatorConfig, baremetalProvisioningConfig BaremetalProvisioningConfig, secrets []*corev1.Secret) *corev1.PodTemplateSpec {
+	podSpec := newMetal3PodSpec(
+		baremetalProvisioningConfig,
+		newMetal3Volumes(baremetalProvisioningConfig),
+		newMetal3InitContainers(config, baremetalProvisioningConfig),
+		newMetal3Containers(config, baremetalProvisioningConfig),
+	)
+
 	return &corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels: map[string]string{
 				"api":     "clusterapi",
 				"k8s-app": "controller",
+				"app":     metal3AppLabels["app"],
 			},
+			Annotations: newPodAnnotations(&podSpec, newMetal3ConfigMap(config, baremetalProvisioningConfig), secrets),
 		},
-		Spec: corev1.PodSpec{
-			Volumes:           volumes,
-			InitContainers:    initContainers,
-			Containers:        containers,
-			HostNetwork:       true,
-			PriorityClassName: "system-node-critical",
-			NodeSelector:      map[string]string{"node-role.kubernetes.io/master": ""},
-			SecurityContext: &corev1.PodSecurityContext{
-				RunAsNonRoot: pointer.BoolPtr(false),
-			},
-			ServiceAccountName: "baremetal-controller",
-			Tolerations:        tolerations,
-		},
+		Spec: podSpec,
 	}
 }
 
@@ -180,15 +488,17 @@ func newMetal3InitContainers(config *OperatorConfig, baremetalProvisioningConfig
 			Image:           config.BaremetalControllers.IronicIpaDownloader,
 			Command:         []string{"/usr/local/bin/get-resource.sh"},
 			ImagePullPolicy: "IfNotPresent",
-			SecurityContext: &corev1.SecurityContext{
-				Privileged: pointer.BoolPtr(true),
-			},
-			VolumeMounts: volumeMounts,
-			Env:          []corev1.EnvVar{},
+			SecurityContext: newSecurityContext(),
+			VolumeMounts:    metal3VolumeMounts(trustedCAVolumeMounts(baremetalProvisioningConfig)...),
+			Env:             proxyEnvVars(baremetalProvisioningConfig),
 		},
 	}
 	initContainers = append(initContainers, createInitContainerMachineOsDownloader(config, baremetalProvisioningConfig))
-	initContainers = append(initContainers, createInitContainerStaticIpSet(config, baremetalProvisioningConfig))
+	initContainers = append(initContainers, createInitContainerHtpasswdGenerator(config))
+	// Without a provisioning network there is no address to manage
+	if baremetalProvisioningConfig.ProvisioningNetwork != metal3v1alpha1.ProvisioningNetworkDisabled {
+		initContainers = append(initContainers, createInitContainerStaticIpSet(config, baremetalProvisioningConfig))
+	}
 	return initContainers
 }
 
@@ -198,13 +508,11 @@ func createInitContainerMachineOsDownloader(config *OperatorConfig, baremetalPro
 		Image:           config.BaremetalControllers.IronicMachineOsDownloader,
 		Command:         []string{"/usr/local/bin/get-resource.sh"},
 		ImagePullPolicy: "IfNotPresent",
-		SecurityContext: &corev1.SecurityContext{
-			Privileged: pointer.BoolPtr(true),
-		},
-		VolumeMounts: volumeMounts,
-		Env: []corev1.EnvVar{
-			buildEnvVar("RHCOS_IMAGE_URL", "rhcos_image_url", baremetalProvisioningConfig),
-		},
+		SecurityContext: newSecurityContext(),
+		VolumeMounts:    metal3VolumeMounts(trustedCAVolumeMounts(baremetalProvisioningConfig)...),
+		Env: append([]corev1.EnvVar{
+			buildEnvVar("RHCOS_IMAGE_URL"),
+		}, proxyEnvVars(baremetalProvisioningConfig)...),
 	}
 	return initContainer
 }
@@ -215,67 +523,97 @@ func createInitContainerStaticIpSet(config *OperatorConfig, baremetalProvisionin
 		Image:           config.BaremetalControllers.IronicStaticIpManager,
 		Command:         []string{"/set-static-ip"},
 		ImagePullPolicy: "IfNotPresent",
-		SecurityContext: &corev1.SecurityContext{
-			Privileged: pointer.BoolPtr(true),
-		},
-		Env: []corev1.EnvVar{
-			buildEnvVar("PROVISIONING_IP", "provisioning_ip", baremetalProvisioningConfig),
-			buildEnvVar("PROVISIONING_INTERFACE", "provisioning_interface", baremetalProvisioningConfig),
-		},
+		SecurityContext: newSecurityContext(networkAdminCapabilities...),
+		Env: append(provisioningIPEnvVars(baremetalProvisioningConfig),
+			buildEnvVar("PROVISIONING_INTERFACE"),
+		),
 	}
 	return initContainer
 }
 
+// provisioningIPEnvVars returns the environment variables holding the
+// provisioning IP of each IP family, for the containers which configure,
+// bind to or advertise them.
+func provisioningIPEnvVars(baremetalProvisioningConfig BaremetalProvisioningConfig) []corev1.EnvVar {
+	envVars := []corev1.EnvVar{buildEnvVar("PROVISIONING_IP")}
+	if isDualStack(baremetalProvisioningConfig) {
+		envVars = append(envVars, buildEnvVar("PROVISIONING_SECONDARY_IP"))
+	}
+	return envVars
+}
+
 func newMetal3Containers(config *OperatorConfig, baremetalProvisioningConfig BaremetalProvisioningConfig) []corev1.Container {
-	//Starting off with the metal3-baremetal-operator container
-	containers := []corev1.Container{
-		{
-			Name:  "metal3-baremetal-operator",
-			Image: config.BaremetalControllers.BaremetalOperator,
-			Ports: []corev1.ContainerPort{
-				{
-					Name:          "metrics",
-					ContainerPort: 60000,
-				},
+	containers := []corev1.Container{}
+	// In the Split workload layout, the baremetal-operator runs in a
+	// Deployment of its own
+	if !isSplitLayout(baremetalProvisioningConfig) {
+		containers = append(containers, createContainerMetal3BaremetalOperator(config, baremetalProvisioningConfig))
+	}
+	// The DHCP server only runs within the metal3 cluster on a managed
+	// provisioning network
+	if baremetalProvisioningConfig.ProvisioningNetwork == metal3v1alpha1.ProvisioningNetworkManaged {
+		containers = append(containers, createContainerMetal3Dnsmasq(config, baremetalProvisioningConfig))
+	}
+	containers = append(containers, createContainerMetal3Mariadb(config, baremetalProvisioningConfig))
+	containers = append(containers, createContainerMetal3Httpd(config, baremetalProvisioningConfig))
+	containers = append(containers, createContainerMetal3IronicConductor(config, baremetalProvisioningConfig))
+	containers = append(containers, createContainerMetal3IronicApi(config, baremetalProvisioningConfig))
+	containers = append(containers, createContainerMetal3IronicInspector(config, baremetalProvisioningConfig))
+	if baremetalProvisioningConfig.ProvisioningNetwork != metal3v1alpha1.ProvisioningNetworkDisabled {
+		containers = append(containers, createContainerMetal3StaticIpManager(config, baremetalProvisioningConfig))
+	}
+	if hasHostFirewall(baremetalProvisioningConfig) {
+		containers = append(containers, createContainerMetal3HostFirewall(config, baremetalProvisioningConfig))
+	}
+	return containers
+}
+
+func createContainerMetal3BaremetalOperator(config *OperatorConfig, baremetalProvisioningConfig BaremetalProvisioningConfig) corev1.Container {
+
+	container := corev1.Container{
+		Name:  "metal3-baremetal-operator",
+		Image: config.BaremetalControllers.BaremetalOperator,
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          "metrics",
+				ContainerPort: 60000,
 			},
-			Command:         []string{"/baremetal-operator"},
-			ImagePullPolicy: "IfNotPresent",
-			Env: []corev1.EnvVar{
-				{
-					Name: "WATCH_NAMESPACE",
-					ValueFrom: &corev1.EnvVarSource{
-						FieldRef: &corev1.ObjectFieldSelector{
-							FieldPath: "metadata.namespace",
-						},
+		},
+		Command:         []string{"/baremetal-operator"},
+		ImagePullPolicy: "IfNotPresent",
+		SecurityContext: newSecurityContext(),
+		VolumeMounts: append([]corev1.VolumeMount{
+			newCACertVolumeMount(),
+		}, newBaremetalOperatorAuthVolumeMounts()...),
+		Env: []corev1.EnvVar{
+			{
+				Name: "WATCH_NAMESPACE",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{
+						FieldPath: "metadata.namespace",
 					},
 				},
-				{
-					Name: "POD_NAME",
-					ValueFrom: &corev1.EnvVarSource{
-						FieldRef: &corev1.ObjectFieldSelector{
-							FieldPath: "metadata.name",
-						},
+			},
+			{
+				Name: "POD_NAME",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{
+						FieldPath: "metadata.name",
 					},
 				},
-				{
-					Name:  "OPERATOR_NAME",
-					Value: "baremetal-operator",
-				},
-				buildEnvVar("DEPLOY_KERNEL_URL", "deploy_kernel_url", baremetalProvisioningConfig),
-				buildEnvVar("DEPLOY_RAMDISK_URL", "deploy_ramdisk_url", baremetalProvisioningConfig),
-				buildEnvVar("IRONIC_ENDPOINT", "ironic_endpoint", baremetalProvisioningConfig),
-				buildEnvVar("IRONIC_INSPECTOR_ENDPOINT", "ironic_inspector_endpoint", baremetalProvisioningConfig),
 			},
+			{
+				Name:  "OPERATOR_NAME",
+				Value: "baremetal-operator",
+			},
+			buildEnvVar("DEPLOY_KERNEL_URL"),
+			buildEnvVar("DEPLOY_RAMDISK_URL"),
+			buildEnvVar("IRONIC_ENDPOINT"),
+			buildEnvVar("IRONIC_INSPECTOR_ENDPOINT"),
+			buildEnvVar("IRONIC_CACERT_FILE"),
 		},
 	}
-	containers = append(containers, createContainerMetal3Dnsmasq(config, baremetalProvisioningConfig))
-	containers = append(containers, createContainerMetal3Mariadb(config))
-	containers = append(containers, createContainerMetal3Httpd(config, baremetalProvisioningConfig))
-	containers = append(containers, createContainerMetal3IronicConductor(config, baremetalProvisioningConfig))
-	containers = append(containers, createContainerMetal3IronicApi(config, baremetalProvisioningConfig))
-	containers = append(containers, createContainerMetal3IronicInspector(config, baremetalProvisioningConfig))
-	containers = append(containers, createContainerMetal3StaticIpManager(config, baremetalProvisioningConfig))
-	return containers
+	return container
 }
 
 func createContainerMetal3Dnsmasq(config *OperatorConfig, baremetalProvisioningConfig BaremetalProvisioningConfig) corev1.Container {
@@ -284,35 +622,43 @@ func createContainerMetal3Dnsmasq(config *OperatorConfig, baremetalProvisioningC
 		Name:            "metal3-dnsmasq",
 		Image:           config.BaremetalControllers.Ironic,
 		ImagePullPolicy: "IfNotPresent",
-		SecurityContext: &corev1.SecurityContext{
-			Privileged: pointer.BoolPtr(true),
-		},
-		Command:      []string{"/bin/rundnsmasq"},
-		VolumeMounts: volumeMounts,
+		SecurityContext: newSecurityContext(networkAdminCapabilities...),
+		Command:         []string{"/bin/rundnsmasq"},
+		VolumeMounts:    volumeMounts,
 		Env: []corev1.EnvVar{
-			buildEnvVar("HTTP_PORT", "http_port", baremetalProvisioningConfig),
-			buildEnvVar("PROVISIONING_INTERFACE", "provisioning_interface", baremetalProvisioningConfig),
-			buildEnvVar("DHCP_RANGE", "dhcp_range", baremetalProvisioningConfig),
+			buildEnvVar("HTTP_PORT"),
+			buildEnvVar("PROVISIONING_INTERFACE"),
+			buildEnvVar("DHCP_RANGE"),
 		},
 	}
+	if isDualStack(baremetalProvisioningConfig) {
+		container.Env = append(container.Env, buildEnvVar("SECONDARY_DHCP_RANGE"))
+	}
+	setProbes(&container, newExecProbeHandler(dnsmasqProbeScript))
 	return container
 }
 
-func createContainerMetal3Mariadb(config *OperatorConfig) corev1.Container {
+func createContainerMetal3Mariadb(config *OperatorConfig, baremetalProvisioningConfig BaremetalProvisioningConfig) corev1.Container {
+	mariadbVolumeMounts := metal3VolumeMounts()
+	if hasPersistentStorage(baremetalProvisioningConfig) {
+		mariadbVolumeMounts = metal3VolumeMounts(corev1.VolumeMount{
+			Name:      baremetalDatabaseVolume,
+			MountPath: mariadbDataDir,
+		})
+	}
 
 	container := corev1.Container{
 		Name:            "metal3-mariadb",
 		Image:           config.BaremetalControllers.Ironic,
 		ImagePullPolicy: "IfNotPresent",
-		SecurityContext: &corev1.SecurityContext{
-			Privileged: pointer.BoolPtr(true),
-		},
-		Command:      []string{"/bin/runmariadb"},
-		VolumeMounts: volumeMounts,
+		SecurityContext: newSecurityContext(),
+		Command:         []string{"/bin/sh", "-c", mariadbStartScript},
+		VolumeMounts:    mariadbVolumeMounts,
 		Env: []corev1.EnvVar{
 			setMariadbPassword(),
 		},
 	}
+	setProbes(&container, newExecProbeHandler(mariadbProbeScript))
 	return container
 }
 
@@ -322,16 +668,30 @@ func createContainerMetal3Httpd(config *OperatorConfig, baremetalProvisioningCon
 		Name:            "metal3-httpd",
 		Image:           config.BaremetalControllers.Ironic,
 		ImagePullPolicy: "IfNotPresent",
-		SecurityContext: &corev1.SecurityContext{
-			Privileged: pointer.BoolPtr(true),
+		SecurityContext: newSecurityContext(),
+		Command:         []string{"/bin/runhttpd"},
+		VolumeMounts:    metal3VolumeMounts(newServingCertVolumeMount(ironicVmediaCertDir)),
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          baremetalHttpPortName,
+				ContainerPort: parsePort(baremetalHttpPort),
+			},
+			{
+				Name:          "https",
+				ContainerPort: parsePort(baremetalVmediaHttpsPort),
+			},
 		},
-		Command:      []string{"/bin/runhttpd"},
-		VolumeMounts: volumeMounts,
 		Env: []corev1.EnvVar{
-			buildEnvVar("HTTP_PORT", "http_port", baremetalProvisioningConfig),
-			buildEnvVar("PROVISIONING_INTERFACE", "provisioning_interface", baremetalProvisioningConfig),
+			buildEnvVar("HTTP_PORT"),
+			buildEnvVar("PROVISIONING_INTERFACE"),
+			buildEnvVar("VMEDIA_TLS_PORT"),
+			buildEnvVar("IRONIC_VMEDIA_CERT_FILE"),
+			buildEnvVar("IRONIC_VMEDIA_KEY_FILE"),
+			buildEnvVar("LISTEN_ALL_INTERFACES"),
 		},
 	}
+	container.Env = append(container.Env, provisioningIPEnvVars(baremetalProvisioningConfig)...)
+	setProbes(&container, newHTTPProbeHandler(getHttpdListenAddress(baremetalProvisioningConfig), baremetalHttpPort, corev1.URISchemeHTTP, "/images/"))
 	return container
 }
 
@@ -341,17 +701,26 @@ func createContainerMetal3IronicConductor(config *OperatorConfig, baremetalProvi
 		Name:            "metal3-ironic-conductor",
 		Image:           config.BaremetalControllers.Ironic,
 		ImagePullPolicy: "IfNotPresent",
-		SecurityContext: &corev1.SecurityContext{
-			Privileged: pointer.BoolPtr(true),
-		},
-		Command:      []string{"/bin/runironic-conductor"},
-		VolumeMounts: volumeMounts,
+		SecurityContext: newSecurityContext(),
+		Command:         []string{"/bin/runironic-conductor"},
+		VolumeMounts:    metal3VolumeMounts(newCACertVolumeMount()),
 		Env: []corev1.EnvVar{
 			setMariadbPassword(),
-			buildEnvVar("HTTP_PORT", "http_port", baremetalProvisioningConfig),
-			buildEnvVar("PROVISIONING_INTERFACE", "provisioning_interface", baremetalProvisioningConfig),
+			buildEnvVar("HTTP_PORT"),
+			buildEnvVar("PROVISIONING_INTERFACE"),
+			buildEnvVar("OS_DEFAULT__DEFAULT_BOOT_INTERFACE"),
+			buildEnvVar("OS_DEFAULT__ENABLED_BOOT_INTERFACES"),
+			buildEnvVar("OS_DEPLOY__EXTERNAL_HTTP_URL"),
+			buildEnvVar("OS_REDFISH__USE_SWIFT"),
+			buildEnvVar("IRONIC_CACERT_FILE"),
+			buildEnvVar("OS_INSPECTOR__AUTH_TYPE"),
+			buildEnvVarFromSecret("OS_INSPECTOR__USERNAME", baremetalIronicInspectorSecretName, baremetalUsernameKey),
+			buildEnvVarFromSecret("OS_INSPECTOR__PASSWORD", baremetalIronicInspectorSecretName, baremetalSecretKey),
 		},
 	}
+	container.Env = append(container.Env, provisioningIPEnvVars(baremetalProvisioningConfig)...)
+	container.Env = append(container.Env, proxyEnvVars(baremetalProvisioningConfig)...)
+	container.VolumeMounts = append(container.VolumeMounts, trustedCAVolumeMounts(baremetalProvisioningConfig)...)
 	return container
 }
 
@@ -361,17 +730,32 @@ func createContainerMetal3IronicApi(config *OperatorConfig, baremetalProvisionin
 		Name:            "metal3-ironic-api",
 		Image:           config.BaremetalControllers.Ironic,
 		ImagePullPolicy: "IfNotPresent",
-		SecurityContext: &corev1.SecurityContext{
-			Privileged: pointer.BoolPtr(true),
+		SecurityContext: newSecurityContext(),
+		Command:         []string{"/bin/runironic-api"},
+		VolumeMounts:    metal3VolumeMounts(newServingCertVolumeMount(ironicCertDir), newHtpasswdVolumeMount(ironicAuthSubPath)),
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          "ironic",
+				ContainerPort: parsePort(baremetalIronicPort),
+			},
 		},
-		Command:      []string{"/bin/runironic-api"},
-		VolumeMounts: volumeMounts,
 		Env: []corev1.EnvVar{
 			setMariadbPassword(),
-			buildEnvVar("HTTP_PORT", "http_port", baremetalProvisioningConfig),
-			buildEnvVar("PROVISIONING_INTERFACE", "provisioning_interface", baremetalProvisioningConfig),
+			buildEnvVar("HTTP_PORT"),
+			buildEnvVar("PROVISIONING_INTERFACE"),
+			buildEnvVar("IRONIC_CERT_FILE"),
+			buildEnvVar("IRONIC_KEY_FILE"),
+			buildEnvVar("OS_DEFAULT__AUTH_STRATEGY"),
+			buildEnvVar("OS_DEFAULT__HTTP_BASIC_AUTH_USER_FILE"),
 		},
 	}
+	container.Env = append(container.Env, provisioningIPEnvVars(baremetalProvisioningConfig)...)
+	if getListenAddress(baremetalProvisioningConfig) != nil {
+		container.Env = append(container.Env, buildEnvVar("OS_API__HOST_IP"))
+	}
+	container.Env = append(container.Env, proxyEnvVars(baremetalProvisioningConfig)...)
+	container.VolumeMounts = append(container.VolumeMounts, trustedCAVolumeMounts(baremetalProvisioningConfig)...)
+	setProbes(&container, newHTTPProbeHandler(getListenAddress(baremetalProvisioningConfig), baremetalIronicPort, corev1.URISchemeHTTPS, "/"))
 	return container
 }
 
@@ -381,14 +765,33 @@ func createContainerMetal3IronicInspector(config *OperatorConfig, baremetalProvi
 		Name:            "metal3-ironic-inspector",
 		Image:           config.BaremetalControllers.IronicInspector,
 		ImagePullPolicy: "IfNotPresent",
-		SecurityContext: &corev1.SecurityContext{
-			Privileged: pointer.BoolPtr(true),
+		SecurityContext: newSecurityContext(),
+		VolumeMounts: metal3VolumeMounts(newServingCertVolumeMount(ironicInspectorCertDir), newCACertVolumeMount(),
+			newHtpasswdVolumeMount(ironicInspectorAuthSubPath)),
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          "inspector",
+				ContainerPort: parsePort(baremetalIronicInspectorPort),
+			},
 		},
-		VolumeMounts: volumeMounts,
 		Env: []corev1.EnvVar{
-			buildEnvVar("PROVISIONING_INTERFACE", "provisioning_interface", baremetalProvisioningConfig),
+			buildEnvVar("PROVISIONING_INTERFACE"),
+			buildEnvVar("IRONIC_INSPECTOR_CERT_FILE"),
+			buildEnvVar("IRONIC_INSPECTOR_KEY_FILE"),
+			buildEnvVar("IRONIC_CACERT_FILE"),
+			buildEnvVar("OS_DEFAULT__AUTH_STRATEGY"),
+			buildEnvVar("OS_DEFAULT__HTTP_BASIC_AUTH_USER_FILE"),
+			buildEnvVar("OS_IRONIC__AUTH_TYPE"),
+			buildEnvVarFromSecret("OS_IRONIC__USERNAME", baremetalIronicSecretName, baremetalUsernameKey),
+			buildEnvVarFromSecret("OS_IRONIC__PASSWORD", baremetalIronicSecretName, baremetalSecretKey),
 		},
 	}
+	if getListenAddress(baremetalProvisioningConfig) != nil {
+		container.Env = append(container.Env, buildEnvVar("OS_DEFAULT__LISTEN_ADDRESS"))
+	}
+	container.Env = append(container.Env, proxyEnvVars(baremetalProvisioningConfig)...)
+	container.VolumeMounts = append(container.VolumeMounts, trustedCAVolumeMounts(baremetalProvisioningConfig)...)
+	setProbes(&container, newHTTPProbeHandler(getListenAddress(baremetalProvisioningConfig), baremetalIronicInspectorPort, corev1.URISchemeHTTPS, "/"))
 	return container
 }
 
@@ -399,13 +802,10 @@ func createContainerMetal3StaticIpManager(config *OperatorConfig, baremetalProvi
 		Image:           config.BaremetalControllers.IronicStaticIpManager,
 		Command:         []string{"/refresh-static-ip"},
 		ImagePullPolicy: "IfNotPresent",
-		SecurityContext: &corev1.SecurityContext{
-			Privileged: pointer.BoolPtr(true),
-		},
-		Env: []corev1.EnvVar{
-			buildEnvVar("PROVISIONING_IP", "provisioning_ip", baremetalProvisioningConfig),
-			buildEnvVar("PROVISIONING_INTERFACE", "provisioning_interface", baremetalProvisioningConfig),
-		},
+		SecurityContext: newSecurityContext(networkAdminCapabilities...),
+		Env: append(provisioningIPEnvVars(baremetalProvisioningConfig),
+			buildEnvVar("PROVISIONING_INTERFACE"),
+		),
 	}
 	return container
 }
@@ -0,0 +1,75 @@
+package provisioning
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// Ironic and Ironic Inspector wait for the database before serving
+	// their APIs, and the conductor migrates it on a new release, so
+	// liveness is only checked once they had time to start
+	probeLivenessInitialDelaySeconds = 60
+	probeLivenessPeriodSeconds       = 30
+	probeLivenessFailureThreshold    = 5
+	probeReadinessPeriodSeconds      = 10
+	probeReadinessFailureThreshold   = 3
+	probeTimeoutSeconds              = 10
+
+	// mariadbProbeScript checks that MariaDB accepts connections
+	mariadbProbeScript = "mysqladmin --user=root ping --silent"
+
+	// dnsmasqProbeScript checks that dnsmasq is running; with DNS
+	// disabled, it answers no query a probe could send
+	dnsmasqProbeScript = "pgrep -x dnsmasq"
+)
+
+// parsePort returns the number of one of the port constants.
+func parsePort(port string) int32 {
+	value := intstr.Parse(port)
+	return int32(value.IntValue())
+}
+
+// newHTTPProbeHandler returns a handler requesting path on port of the
+// host network, at listenAddress when the server is bound to it. The API
+// roots of Ironic and Ironic Inspector do not require authentication, and
+// the kubelet does not verify certificates.
+func newHTTPProbeHandler(listenAddress *string, port string, scheme corev1.URIScheme, path string) corev1.Handler {
+	handler := corev1.Handler{
+		HTTPGet: &corev1.HTTPGetAction{
+			Path:   path,
+			Port:   intstr.Parse(port),
+			Scheme: scheme,
+		},
+	}
+	if listenAddress != nil {
+		handler.HTTPGet.Host = *listenAddress
+	}
+	return handler
+}
+
+func newExecProbeHandler(script string) corev1.Handler {
+	return corev1.Handler{
+		Exec: &corev1.ExecAction{
+			Command: []string{"/bin/sh", "-c", script},
+		},
+	}
+}
+
+// setProbes sets the liveness and readiness probes of container, which
+// both use handler.
+func setProbes(container *corev1.Container, handler corev1.Handler) {
+	container.LivenessProbe = &corev1.Probe{
+		Handler:             *handler.DeepCopy(),
+		InitialDelaySeconds: probeLivenessInitialDelaySeconds,
+		PeriodSeconds:       probeLivenessPeriodSeconds,
+		TimeoutSeconds:      probeTimeoutSeconds,
+		FailureThreshold:    probeLivenessFailureThreshold,
+	}
+	container.ReadinessProbe = &corev1.Probe{
+		Handler:          handler,
+		PeriodSeconds:    probeReadinessPeriodSeconds,
+		TimeoutSeconds:   probeTimeoutSeconds,
+		FailureThreshold: probeReadinessFailureThreshold,
+	}
+}
@@ -0,0 +1,87 @@
+package provisioning
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestMetal3Probes(t *testing.T) {
+	baremetalConfig := getBaremetalProvisioningConfig(provisioningCR)
+	containers := map[string]corev1.Container{}
+	for _, container := range newMetal3Containers(&OperatorConfig{}, baremetalConfig) {
+		containers[container.Name] = container
+	}
+
+	tCases := []struct {
+		name           string
+		expectedPort   string
+		expectedScheme corev1.URIScheme
+		expectedScript string
+	}{
+		{
+			name:           "metal3-ironic-api",
+			expectedPort:   baremetalIronicPort,
+			expectedScheme: corev1.URISchemeHTTPS,
+		},
+		{
+			name:           "metal3-ironic-inspector",
+			expectedPort:   baremetalIronicInspectorPort,
+			expectedScheme: corev1.URISchemeHTTPS,
+		},
+		{
+			name:           "metal3-httpd",
+			expectedPort:   baremetalHttpPort,
+			expectedScheme: corev1.URISchemeHTTP,
+		},
+		{
+			name:           "metal3-mariadb",
+			expectedScript: mariadbProbeScript,
+		},
+		{
+			name:           "metal3-dnsmasq",
+			expectedScript: dnsmasqProbeScript,
+		},
+	}
+
+	for _, tc := range tCases {
+		t.Run(tc.name, func(t *testing.T) {
+			container, ok := containers[tc.name]
+			if !ok {
+				t.Fatalf("Container %s is missing", tc.name)
+			}
+			for probeType, probe := range map[string]*corev1.Probe{"liveness": container.LivenessProbe, "readiness": container.ReadinessProbe} {
+				if probe == nil {
+					t.Errorf("Expected a %s probe", probeType)
+					continue
+				}
+				if tc.expectedScript != "" {
+					if probe.Exec == nil || probe.Exec.Command[len(probe.Exec.Command)-1] != tc.expectedScript {
+						t.Errorf("Expected the %s probe to run %q, got %+v", probeType, tc.expectedScript, probe.Handler)
+					}
+					continue
+				}
+				if probe.HTTPGet == nil {
+					t.Errorf("Expected an HTTP %s probe, got %+v", probeType, probe.Handler)
+					continue
+				}
+				if probe.HTTPGet.Port.String() != tc.expectedPort || probe.HTTPGet.Scheme != tc.expectedScheme {
+					t.Errorf("Expected the %s probe on %s port %s, got %s port %s", probeType, tc.expectedScheme, tc.expectedPort, probe.HTTPGet.Scheme, probe.HTTPGet.Port.String())
+				}
+			}
+
+			// The probed port is the one the container declares
+			if tc.expectedPort != "" {
+				found := false
+				for _, port := range container.Ports {
+					if port.ContainerPort == parsePort(tc.expectedPort) {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("Expected %s to declare port %s, got %+v", tc.name, tc.expectedPort, container.Ports)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package provisioning
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	osconfigv1 "github.com/openshift/api/config/v1"
+)
+
+const (
+	// clusterConfigName is the name of the cluster-wide configuration
+	// objects, such as the Infrastructure, Proxy and Network.
+	clusterConfigName = "cluster"
+
+	// baremetalTrustedCAConfigMap is injected with the CA bundle trusted
+	// by the cluster, including the trustedCA of the cluster-wide proxy,
+	// as it carries the trustedCAInjectLabel.
+	baremetalTrustedCAConfigMap = "metal3-trusted-ca"
+	trustedCAInjectLabel        = "config.openshift.io/inject-trusted-cabundle"
+	trustedCABundleKey          = "ca-bundle.crt"
+
+	// The injected bundle replaces the one of the container images.
+	trustedCAVolume     = "metal3-trusted-ca"
+	trustedCADir        = "/etc/pki/ca-trust/extracted/pem"
+	trustedCABundleFile = "tls-ca-bundle.pem"
+)
+
+// setProxyConfig copies the cluster-wide proxy into baremetalProvisioningConfig.
+// The proxy is bypassed for the provisioning network and the networks of
+// the cluster, so that Ironic keeps reaching the hosts and services directly.
+func (r *ReconcileProvisioning) setProxyConfig(baremetalProvisioningConfig *BaremetalProvisioningConfig) error {
+	proxy := &osconfigv1.Proxy{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: clusterConfigName}, proxy)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	network := &osconfigv1.Network{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: clusterConfigName}, network)
+	if errors.IsNotFound(err) {
+		network = nil
+	} else if err != nil {
+		return err
+	}
+
+	baremetalProvisioningConfig.HTTPProxy = proxy.Status.HTTPProxy
+	baremetalProvisioningConfig.HTTPSProxy = proxy.Status.HTTPSProxy
+	baremetalProvisioningConfig.NoProxy = getNoProxy(proxy, network, *baremetalProvisioningConfig)
+	return nil
+}
+
+// getNoProxy returns the noProxy of the cluster-wide proxy, extended with
+// the provisioning network and IP and the networks of the cluster. It is
+// empty when no proxy is used.
+func getNoProxy(proxy *osconfigv1.Proxy, network *osconfigv1.Network, baremetalProvisioningConfig BaremetalProvisioningConfig) string {
+	if proxy.Status.HTTPProxy == "" && proxy.Status.HTTPSProxy == "" {
+		return ""
+	}
+
+	entries := strings.Split(proxy.Status.NoProxy, ",")
+	entries = append(entries, getProvisioningCIDRs(baremetalProvisioningConfig, false)...)
+	entries = append(entries, getProvisioningCIDRs(baremetalProvisioningConfig, true)...)
+	entries = append(entries, baremetalProvisioningConfig.ProvisioningIp, baremetalProvisioningConfig.ProvisioningSecondaryIp)
+	if network != nil {
+		for _, clusterNetwork := range network.Status.ClusterNetwork {
+			entries = append(entries, clusterNetwork.CIDR)
+		}
+		entries = append(entries, network.Status.ServiceNetwork...)
+	}
+
+	noProxy := []string{}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || seen[entry] {
+			continue
+		}
+		seen[entry] = true
+		noProxy = append(noProxy, entry)
+	}
+	return strings.Join(noProxy, ",")
+}
+
+// usesProxy reports whether the cluster-wide proxy is set.
+func usesProxy(baremetalProvisioningConfig BaremetalProvisioningConfig) bool {
+	return baremetalProvisioningConfig.HTTPProxy != "" || baremetalProvisioningConfig.HTTPSProxy != ""
+}
+
+// proxyEnvVars returns the environment variables of the containers
+// reaching outside of the cluster. Those left empty by the cluster-wide
+// proxy are not set.
+func proxyEnvVars(baremetalProvisioningConfig BaremetalProvisioningConfig) []corev1.EnvVar {
+	envVars := []corev1.EnvVar{}
+	if baremetalProvisioningConfig.HTTPProxy != "" {
+		envVars = append(envVars, buildEnvVar("HTTP_PROXY"))
+	}
+	if baremetalProvisioningConfig.HTTPSProxy != "" {
+		envVars = append(envVars, buildEnvVar("HTTPS_PROXY"))
+	}
+	if baremetalProvisioningConfig.NoProxy != "" {
+		envVars = append(envVars, buildEnvVar("NO_PROXY"))
+	}
+	return envVars
+}
+
+func newTrustedCAConfigMap(config *OperatorConfig) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      baremetalTrustedCAConfigMap,
+			Namespace: config.TargetNamespace,
+			Labels:    map[string]string{trustedCAInjectLabel: "true"},
+		},
+	}
+}
+
+// ensureTrustedCAConfigMap creates the ConfigMap the trusted CA bundle is
+// injected into. The bundle of an existing ConfigMap is kept as it is, as
+// it is only written by the injection.
+func (r *ReconcileProvisioning) ensureTrustedCAConfigMap(ownerReferences []metav1.OwnerReference) error {
+	configMap := newTrustedCAConfigMap(r.config)
+	configMap.OwnerReferences = ownerReferences
+	existing := &corev1.ConfigMap{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: configMap.Name, Namespace: configMap.Namespace}, existing)
+	if errors.IsNotFound(err) {
+		log.Info("Creating the trusted CA ConfigMap", "ConfigMap.Namespace", configMap.Namespace, "ConfigMap.Name", configMap.Name)
+		return r.client.Create(context.TODO(), configMap)
+	} else if err != nil {
+		return err
+	}
+
+	if existing.Labels[trustedCAInjectLabel] == "true" {
+		return nil
+	}
+	if existing.Labels == nil {
+		existing.Labels = map[string]string{}
+	}
+	existing.Labels[trustedCAInjectLabel] = "true"
+	return r.client.Update(context.TODO(), existing)
+}
+
+// newTrustedCAVolume returns the volume holding the injected CA bundle.
+// It is not optional, so that the containers do not start with an empty
+// bundle before it is injected.
+func newTrustedCAVolume() corev1.Volume {
+	return corev1.Volume{
+		Name: trustedCAVolume,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: baremetalTrustedCAConfigMap},
+				Items: []corev1.KeyToPath{
+					{Key: trustedCABundleKey, Path: trustedCABundleFile},
+				},
+			},
+		},
+	}
+}
+
+// trustedCAVolumeMounts returns the mount of the injected CA bundle, for
+// the containers going through the cluster-wide proxy, if any.
+func trustedCAVolumeMounts(baremetalProvisioningConfig BaremetalProvisioningConfig) []corev1.VolumeMount {
+	if !usesProxy(baremetalProvisioningConfig) {
+		return nil
+	}
+	return []corev1.VolumeMount{
+		{
+			Name:      trustedCAVolume,
+			MountPath: trustedCADir,
+			ReadOnly:  true,
+		},
+	}
+}
@@ -0,0 +1,166 @@
+package provisioning
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	configv1 "github.com/openshift/api/config/v1"
+)
+
+func TestSetProxyConfig(t *testing.T) {
+	network := &configv1.Network{
+		ObjectMeta: metav1.ObjectMeta{Name: clusterConfigName},
+		Status: configv1.NetworkStatus{
+			ClusterNetwork: []configv1.ClusterNetworkEntry{{CIDR: "10.128.0.0/14"}},
+			ServiceNetwork: []string{"172.30.0.0/16"},
+		},
+	}
+
+	tCases := []struct {
+		name               string
+		proxy              *configv1.ProxyStatus
+		expectedHTTPProxy  string
+		expectedHTTPSProxy string
+		expectedNoProxy    string
+		expectedEnv        []string
+	}{
+		{
+			name: "NoProxy",
+		},
+		{
+			name:  "ProxyNotSet",
+			proxy: &configv1.ProxyStatus{NoProxy: ".cluster.local"},
+		},
+		{
+			name: "Proxy",
+			proxy: &configv1.ProxyStatus{
+				HTTPProxy:  "http://proxy.example.com:3128",
+				HTTPSProxy: "https://proxy.example.com:3129",
+				NoProxy:    ".cluster.local,172.30.0.0/16,localhost",
+			},
+			expectedHTTPProxy:  "http://proxy.example.com:3128",
+			expectedHTTPSProxy: "https://proxy.example.com:3129",
+			expectedNoProxy:    ".cluster.local,172.30.0.0/16,localhost,172.30.20.0/24,172.30.20.3,10.128.0.0/14",
+			expectedEnv:        []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"},
+		},
+		{
+			name: "HTTPSProxyOnly",
+			proxy: &configv1.ProxyStatus{
+				HTTPSProxy: "https://proxy.example.com:3129",
+			},
+			expectedHTTPSProxy: "https://proxy.example.com:3129",
+			expectedNoProxy:    "172.30.20.0/24,172.30.20.3,10.128.0.0/14,172.30.0.0/16",
+			expectedEnv:        []string{"HTTPS_PROXY", "NO_PROXY"},
+		},
+	}
+
+	for _, tc := range tCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeClient := &fakeObjectClient{objects: map[string]runtime.Object{objectKey(network): network}}
+			if tc.proxy != nil {
+				proxy := &configv1.Proxy{ObjectMeta: metav1.ObjectMeta{Name: clusterConfigName}, Status: *tc.proxy}
+				fakeClient.objects[objectKey(proxy)] = proxy
+			}
+			r := &ReconcileProvisioning{client: fakeClient}
+
+			baremetalConfig := getBaremetalProvisioningConfig(provisioningCR)
+			if err := r.setProxyConfig(&baremetalConfig); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if baremetalConfig.HTTPProxy != tc.expectedHTTPProxy || baremetalConfig.HTTPSProxy != tc.expectedHTTPSProxy {
+				t.Errorf("Expected proxies %q and %q, got %q and %q", tc.expectedHTTPProxy, tc.expectedHTTPSProxy, baremetalConfig.HTTPProxy, baremetalConfig.HTTPSProxy)
+			}
+			if baremetalConfig.NoProxy != tc.expectedNoProxy {
+				t.Errorf("Expected NO_PROXY=%q, got %q", tc.expectedNoProxy, baremetalConfig.NoProxy)
+			}
+
+			configMap := newMetal3ConfigMap(&OperatorConfig{}, baremetalConfig)
+			podSpec := newMetal3PodTemplateSpec(&OperatorConfig{}, baremetalConfig, nil).Spec
+			proxied := map[string]bool{
+				"metal3-ipa-downloader":        true,
+				"metal3-machine-os-downloader": true,
+				"metal3-ironic-conductor":      true,
+				"metal3-ironic-api":            true,
+				"metal3-ironic-inspector":      true,
+			}
+			for _, container := range append(podSpec.InitContainers, podSpec.Containers...) {
+				env := map[string]string{}
+				for _, envVar := range container.Env {
+					if envVar.ValueFrom != nil && envVar.ValueFrom.ConfigMapKeyRef != nil {
+						env[envVar.Name] = configMap.Data[envVar.ValueFrom.ConfigMapKeyRef.Key]
+					}
+				}
+				actualEnv := []string{}
+				for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"} {
+					if _, ok := env[name]; ok {
+						actualEnv = append(actualEnv, name)
+					}
+				}
+				expectedEnv := []string{}
+				if proxied[container.Name] {
+					expectedEnv = append(expectedEnv, tc.expectedEnv...)
+				}
+				if !reflect.DeepEqual(actualEnv, expectedEnv) {
+					t.Errorf("Expected %s to set %v, got %v", container.Name, expectedEnv, actualEnv)
+				}
+				if actual, ok := env["HTTPS_PROXY"]; ok && actual != tc.expectedHTTPSProxy {
+					t.Errorf("Expected %s to set HTTPS_PROXY=%q, got %q", container.Name, tc.expectedHTTPSProxy, actual)
+				}
+				if actual, ok := env["NO_PROXY"]; ok && actual != tc.expectedNoProxy {
+					t.Errorf("Expected %s to set NO_PROXY=%q, got %q", container.Name, tc.expectedNoProxy, actual)
+				}
+
+				trusted := false
+				for _, mount := range container.VolumeMounts {
+					trusted = trusted || (mount.Name == trustedCAVolume && mount.MountPath == trustedCADir)
+				}
+				if expected := proxied[container.Name] && len(tc.expectedEnv) > 0; trusted != expected {
+					t.Errorf("Expected %s to mount the trusted CA bundle: %t", container.Name, expected)
+				}
+			}
+
+			_, configMapNames := podSpecReferences(&podSpec)
+			if configMapNames[baremetalTrustedCAConfigMap] != (len(tc.expectedEnv) > 0) {
+				t.Errorf("Expected the trusted CA bundle to be mounted only through a proxy")
+			}
+		})
+	}
+}
+
+func TestEnsureTrustedCAConfigMap(t *testing.T) {
+	fakeClient := &fakeObjectClient{objects: map[string]runtime.Object{}}
+	r := &ReconcileProvisioning{
+		client: fakeClient,
+		config: &OperatorConfig{TargetNamespace: "test-namespace"},
+	}
+
+	if err := r.ensureTrustedCAConfigMap(nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	configMap, ok := fakeClient.objects["ConfigMap/"+baremetalTrustedCAConfigMap].(*corev1.ConfigMap)
+	if !ok || configMap.Labels[trustedCAInjectLabel] != "true" {
+		t.Fatalf("Expected a ConfigMap to inject the trusted CA bundle into, got %v", configMap)
+	}
+
+	// The injected bundle is kept, and the label restored
+	configMap.Labels = nil
+	configMap.Data = map[string]string{trustedCABundleKey: "injected"}
+	writes := fakeClient.writes
+	if err := r.ensureTrustedCAConfigMap(nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	configMap = fakeClient.objects["ConfigMap/"+baremetalTrustedCAConfigMap].(*corev1.ConfigMap)
+	if configMap.Labels[trustedCAInjectLabel] != "true" || configMap.Data[trustedCABundleKey] != "injected" {
+		t.Errorf("Expected the label to be restored and the bundle kept, got %v", configMap)
+	}
+	if err := r.ensureTrustedCAConfigMap(nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fakeClient.writes != writes+1 {
+		t.Errorf("Expected a single write to restore the label, got %d", fakeClient.writes-writes)
+	}
+}
@@ -0,0 +1,76 @@
+package provisioning
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	metal3v1alpha1 "github.com/openshift/cluster-baremetal-operator/pkg/apis/metal3/v1alpha1"
+)
+
+// defaultContainerRequests are the resources requested by each of the
+// metal3 containers unless overridden in the Provisioning CR. Like the
+// other control plane components, they set no limits.
+var defaultContainerRequests = map[string]corev1.ResourceList{
+	"metal3-baremetal-operator":    newResourceList("10m", "50Mi"),
+	"metal3-dnsmasq":               newResourceList("5m", "10Mi"),
+	"metal3-mariadb":               newResourceList("10m", "100Mi"),
+	"metal3-httpd":                 newResourceList("5m", "30Mi"),
+	"metal3-ironic-conductor":      newResourceList("10m", "300Mi"),
+	"metal3-ironic-api":            newResourceList("10m", "100Mi"),
+	"metal3-ironic-inspector":      newResourceList("10m", "100Mi"),
+	"metal3-static-ip-manager":     newResourceList("5m", "5Mi"),
+	"metal3-ipa-downloader":        newResourceList("10m", "50Mi"),
+	"metal3-machine-os-downloader": newResourceList("10m", "50Mi"),
+	"metal3-static-ip-set":         newResourceList("5m", "5Mi"),
+	"metal3-htpasswd-generator":    newResourceList("5m", "5Mi"),
+	"metal3-host-firewall":         newResourceList("5m", "10Mi"),
+}
+
+func newResourceList(cpu, memory string) corev1.ResourceList {
+	return corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse(cpu),
+		corev1.ResourceMemory: resource.MustParse(memory),
+	}
+}
+
+// setContainerResources sets the resources of each container of podSpec
+// to its default requests, merged with the overrides of the Provisioning
+// CR.
+func setContainerResources(podSpec *corev1.PodSpec, overrides []metal3v1alpha1.ContainerResources) {
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for i := range containers {
+			containers[i].Resources = getContainerResources(containers[i].Name, overrides)
+		}
+	}
+}
+
+// getContainerResources returns the resources of the container called
+// name. The requests set by its override replace the default ones, and a
+// request is lowered to the limit it would otherwise exceed.
+func getContainerResources(name string, overrides []metal3v1alpha1.ContainerResources) corev1.ResourceRequirements {
+	resources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{},
+	}
+	for resourceName, quantity := range defaultContainerRequests[name] {
+		resources.Requests[resourceName] = quantity.DeepCopy()
+	}
+
+	for _, override := range overrides {
+		if override.Name != name {
+			continue
+		}
+		for resourceName, quantity := range override.Resources.Requests {
+			resources.Requests[resourceName] = quantity.DeepCopy()
+		}
+		if len(override.Resources.Limits) > 0 {
+			resources.Limits = override.Resources.Limits.DeepCopy()
+		}
+	}
+
+	for resourceName, limit := range resources.Limits {
+		if request, ok := resources.Requests[resourceName]; ok && request.Cmp(limit) > 0 {
+			resources.Requests[resourceName] = limit.DeepCopy()
+		}
+	}
+	return resources
+}
@@ -0,0 +1,108 @@
+package provisioning
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	metal3v1alpha1 "github.com/openshift/cluster-baremetal-operator/pkg/apis/metal3/v1alpha1"
+)
+
+func TestDefaultContainerRequests(t *testing.T) {
+	for _, name := range metal3v1alpha1.Metal3ContainerNames {
+		if _, ok := defaultContainerRequests[name]; !ok {
+			t.Errorf("Expected default requests for %s", name)
+		}
+	}
+
+	operatorConfig := &OperatorConfig{TargetNamespace: "test-namespace"}
+	split := provisioningCR.DeepCopy()
+	split.Spec.WorkloadLayout = metal3v1alpha1.WorkloadLayoutSplit
+	templates := []*corev1.PodTemplateSpec{
+		newMetal3PodTemplateSpec(operatorConfig, getBaremetalProvisioningConfig(provisioningCR), nil),
+		&newBaremetalOperatorDeployment(operatorConfig, getBaremetalProvisioningConfig(split), nil).Spec.Template,
+	}
+	for _, template := range templates {
+		for _, container := range append(template.Spec.InitContainers, template.Spec.Containers...) {
+			if _, ok := defaultContainerRequests[container.Name]; !ok {
+				t.Errorf("Container %s is not among the containers whose resources may be overridden", container.Name)
+			}
+			if container.Resources.Requests.Cpu().IsZero() || container.Resources.Requests.Memory().IsZero() {
+				t.Errorf("Expected cpu and memory requests for %s, got %v", container.Name, container.Resources.Requests)
+			}
+			if len(container.Resources.Limits) != 0 {
+				t.Errorf("Expected no default limits for %s, got %v", container.Name, container.Resources.Limits)
+			}
+		}
+	}
+}
+
+func TestGetContainerResources(t *testing.T) {
+	overrides := []metal3v1alpha1.ContainerResources{
+		{
+			Name: "metal3-ironic-conductor",
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("500Mi")},
+				Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+			},
+		},
+		{
+			Name: "metal3-mariadb",
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("5m")},
+			},
+		},
+	}
+
+	tCases := []struct {
+		name           string
+		expectedCPU    string
+		expectedMemory string
+		expectedLimits corev1.ResourceList
+	}{
+		{
+			name:           "metal3-httpd",
+			expectedCPU:    "5m",
+			expectedMemory: "30Mi",
+		},
+		{
+			name:           "metal3-ironic-conductor",
+			expectedCPU:    "10m",
+			expectedMemory: "500Mi",
+			expectedLimits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+		},
+		{
+			// The default request is lowered to the limit
+			name:           "metal3-mariadb",
+			expectedCPU:    "5m",
+			expectedMemory: "100Mi",
+			expectedLimits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("5m")},
+		},
+	}
+
+	for _, tc := range tCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resources := getContainerResources(tc.name, overrides)
+			if resources.Requests.Cpu().Cmp(resource.MustParse(tc.expectedCPU)) != 0 {
+				t.Errorf("Expected a cpu request of %s, got %s", tc.expectedCPU, resources.Requests.Cpu())
+			}
+			if resources.Requests.Memory().Cmp(resource.MustParse(tc.expectedMemory)) != 0 {
+				t.Errorf("Expected a memory request of %s, got %s", tc.expectedMemory, resources.Requests.Memory())
+			}
+			if len(resources.Limits) != len(tc.expectedLimits) {
+				t.Errorf("Expected limits %v, got %v", tc.expectedLimits, resources.Limits)
+			}
+			for name, expected := range tc.expectedLimits {
+				if limit := resources.Limits[name]; limit.Cmp(expected) != 0 {
+					t.Errorf("Expected a %s limit of %s, got %s", name, expected.String(), limit.String())
+				}
+			}
+		})
+	}
+
+	// The overrides of the CR are not modified
+	if _, ok := overrides[1].Resources.Requests[corev1.ResourceCPU]; ok {
+		t.Errorf("Expected the overrides to be left unchanged, got %v", overrides[1].Resources)
+	}
+}
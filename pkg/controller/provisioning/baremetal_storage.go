@@ -0,0 +1,190 @@
+package provisioning
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	osoperatorv1 "github.com/openshift/api/operator/v1"
+	metal3v1alpha1 "github.com/openshift/cluster-baremetal-operator/pkg/apis/metal3/v1alpha1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+)
+
+const (
+	// The persistent volume claims backing the shared volume, which holds
+	// the images served to hosts, and the MariaDB data directory
+	baremetalImageCacheClaimName = "metal3-image-cache"
+	baremetalDatabaseClaimName   = "metal3-database"
+	baremetalDatabaseVolume      = "metal3-database"
+	mariadbDataDir               = "/var/lib/mysql"
+
+	defaultImageCacheSize = "20Gi"
+	defaultDatabaseSize   = "1Gi"
+
+	// The Provisioning status conditions reporting claims that are not
+	// bound to a persistent volume
+	provisioningStorageProgressing = "StorageProgressing"
+	provisioningStorageDegraded    = "StorageDegraded"
+
+	reasonClaimPending = "ClaimPending"
+	reasonClaimLost    = "ClaimLost"
+)
+
+// hasPersistentStorage reports whether the metal3 pod keeps its image
+// cache and database in persistent volumes.
+func hasPersistentStorage(baremetalConfig BaremetalProvisioningConfig) bool {
+	return baremetalConfig.Storage != nil
+}
+
+// newStorageClaims returns the persistent volume claims of the metal3 pod,
+// or none when its storage is not persistent.
+func newStorageClaims(config *OperatorConfig, baremetalConfig BaremetalProvisioningConfig, ownerReferences []metav1.OwnerReference) []*corev1.PersistentVolumeClaim {
+	if !hasPersistentStorage(baremetalConfig) {
+		return nil
+	}
+	storage := baremetalConfig.Storage
+	return []*corev1.PersistentVolumeClaim{
+		newPersistentVolumeClaim(config, baremetalImageCacheClaimName, storage.StorageClassName,
+			getStorageSize(storage.ImageCacheSize, defaultImageCacheSize), ownerReferences),
+		newPersistentVolumeClaim(config, baremetalDatabaseClaimName, storage.StorageClassName,
+			getStorageSize(storage.DatabaseSize, defaultDatabaseSize), ownerReferences),
+	}
+}
+
+func getStorageSize(size *resource.Quantity, defaultSize string) resource.Quantity {
+	if size == nil {
+		return resource.MustParse(defaultSize)
+	}
+	return size.DeepCopy()
+}
+
+func newPersistentVolumeClaim(config *OperatorConfig, name string, storageClassName string, size resource.Quantity, ownerReferences []metav1.OwnerReference) *corev1.PersistentVolumeClaim {
+	claim := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       config.TargetNamespace,
+			OwnerReferences: ownerReferences,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: size,
+				},
+			},
+		},
+	}
+	if storageClassName != "" {
+		claim.Spec.StorageClassName = &storageClassName
+	}
+	return claim
+}
+
+// ensureStorageClaims creates the claims that do not exist yet, and returns
+// them as found in the cluster. The spec of a claim is immutable but for
+// its size, which is only ever increased, as volumes cannot shrink.
+func (r *ReconcileProvisioning) ensureStorageClaims(claims []*corev1.PersistentVolumeClaim) ([]*corev1.PersistentVolumeClaim, error) {
+	actualClaims := []*corev1.PersistentVolumeClaim{}
+	for _, claim := range claims {
+		existing := &corev1.PersistentVolumeClaim{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: claim.Name, Namespace: claim.Namespace}, existing)
+		if errors.IsNotFound(err) {
+			log.Info("Creating PersistentVolumeClaim", "PersistentVolumeClaim.Namespace", claim.Namespace, "PersistentVolumeClaim.Name", claim.Name)
+			if err := r.client.Create(context.TODO(), claim); err != nil {
+				return nil, err
+			}
+			actualClaims = append(actualClaims, claim)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		size := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+		if size.Cmp(existing.Spec.Resources.Requests[corev1.ResourceStorage]) > 0 {
+			log.Info("Expanding PersistentVolumeClaim", "PersistentVolumeClaim.Namespace", existing.Namespace, "PersistentVolumeClaim.Name", existing.Name, "Size", size.String())
+			existing.Spec.Resources.Requests[corev1.ResourceStorage] = size
+			if err := r.client.Update(context.TODO(), existing); err != nil {
+				return nil, err
+			}
+		}
+		actualClaims = append(actualClaims, existing)
+	}
+	return actualClaims, nil
+}
+
+// setStorageConditions reports on the status of instance the claims that
+// are still waiting for a persistent volume, and those whose volume is
+// lost, which needs an administrator to look into it.
+func setStorageConditions(instance *metal3v1alpha1.Provisioning, claims []*corev1.PersistentVolumeClaim) {
+	pending := []string{}
+	lost := []string{}
+	for _, claim := range claims {
+		switch claim.Status.Phase {
+		case corev1.ClaimBound:
+		case corev1.ClaimLost:
+			lost = append(lost, claim.Name)
+		default:
+			pending = append(pending, claim.Name)
+		}
+	}
+
+	progressing := osoperatorv1.OperatorCondition{
+		Type:   provisioningStorageProgressing,
+		Status: osoperatorv1.ConditionFalse,
+		Reason: reasonAsExpected,
+	}
+	if len(pending) > 0 {
+		progressing.Status = osoperatorv1.ConditionTrue
+		progressing.Reason = reasonClaimPending
+		progressing.Message = fmt.Sprintf("Waiting for persistent volumes to be bound to claims %s", strings.Join(pending, ", "))
+	}
+	v1helpers.SetOperatorCondition(&instance.Status.Conditions, progressing)
+
+	degraded := osoperatorv1.OperatorCondition{
+		Type:   provisioningStorageDegraded,
+		Status: osoperatorv1.ConditionFalse,
+		Reason: reasonAsExpected,
+	}
+	if len(lost) > 0 {
+		degraded.Status = osoperatorv1.ConditionTrue
+		degraded.Reason = reasonClaimLost
+		degraded.Message = fmt.Sprintf("The persistent volumes bound to claims %s are lost", strings.Join(lost, ", "))
+	}
+	v1helpers.SetOperatorCondition(&instance.Status.Conditions, degraded)
+}
+
+// newSharedVolume returns the volume shared by the metal3 containers,
+// which is only as persistent as the pod unless it is backed by a claim.
+func newSharedVolume(baremetalConfig BaremetalProvisioningConfig) corev1.Volume {
+	volume := corev1.Volume{
+		Name: baremetalSharedVolume,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+	if hasPersistentStorage(baremetalConfig) {
+		volume.VolumeSource = corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: baremetalImageCacheClaimName,
+			},
+		}
+	}
+	return volume
+}
+
+func newDatabaseVolume() corev1.Volume {
+	return corev1.Volume{
+		Name: baremetalDatabaseVolume,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: baremetalDatabaseClaimName,
+			},
+		},
+	}
+}
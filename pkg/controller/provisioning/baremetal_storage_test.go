@@ -0,0 +1,107 @@
+package provisioning
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	metal3v1alpha1 "github.com/openshift/cluster-baremetal-operator/pkg/apis/metal3/v1alpha1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+)
+
+func TestNewStorageClaims(t *testing.T) {
+	operatorConfig := &OperatorConfig{TargetNamespace: "test-namespace"}
+	baremetalConfig := getBaremetalProvisioningConfig(provisioningCR)
+	if claims := newStorageClaims(operatorConfig, baremetalConfig, nil); len(claims) != 0 {
+		t.Errorf("Expected no claims without storage, got %d", len(claims))
+	}
+
+	imageCacheSize := resource.MustParse("50Gi")
+	baremetalConfig.Storage = &metal3v1alpha1.ProvisioningStorage{
+		StorageClassName: "standard",
+		ImageCacheSize:   &imageCacheSize,
+	}
+	claims := newStorageClaims(operatorConfig, baremetalConfig, nil)
+	expectedSizes := map[string]string{
+		baremetalImageCacheClaimName: "50Gi",
+		baremetalDatabaseClaimName:   defaultDatabaseSize,
+	}
+	if len(claims) != len(expectedSizes) {
+		t.Fatalf("Expected %d claims, got %d", len(expectedSizes), len(claims))
+	}
+	for _, claim := range claims {
+		size := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+		if expected := resource.MustParse(expectedSizes[claim.Name]); size.Cmp(expected) != 0 {
+			t.Errorf("Expected claim %s of %s, got %s", claim.Name, expected.String(), size.String())
+		}
+		if claim.Spec.StorageClassName == nil || *claim.Spec.StorageClassName != "standard" {
+			t.Errorf("Expected claim %s of StorageClass standard, got %v", claim.Name, claim.Spec.StorageClassName)
+		}
+	}
+}
+
+func TestPersistentStoragePod(t *testing.T) {
+	operatorConfig := &OperatorConfig{TargetNamespace: "test-namespace"}
+	instance := provisioningCR.DeepCopy()
+	instance.Spec.Storage = &metal3v1alpha1.ProvisioningStorage{}
+	deployment := newMetal3Deployment(operatorConfig, getBaremetalProvisioningConfig(instance), nil)
+
+	claimNames := map[string]string{}
+	for _, volume := range deployment.Spec.Template.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			claimNames[volume.Name] = volume.PersistentVolumeClaim.ClaimName
+		}
+	}
+	if claimNames[baremetalSharedVolume] != baremetalImageCacheClaimName || claimNames[baremetalDatabaseVolume] != baremetalDatabaseClaimName {
+		t.Errorf("Expected the shared volume and the database on claims, got %v", claimNames)
+	}
+
+	found := false
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		for _, mount := range container.VolumeMounts {
+			if mount.Name != baremetalDatabaseVolume {
+				continue
+			}
+			if container.Name != "metal3-mariadb" || mount.MountPath != mariadbDataDir {
+				t.Errorf("Unexpected mount of the database volume at %s in %s", mount.MountPath, container.Name)
+			}
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected the database volume to be mounted in metal3-mariadb")
+	}
+	if deployment.Spec.Strategy.Type != appsv1.RecreateDeploymentStrategyType {
+		t.Errorf("Expected the Recreate strategy, got %q", deployment.Spec.Strategy.Type)
+	}
+}
+
+func TestSetStorageConditions(t *testing.T) {
+	instance := provisioningCR.DeepCopy()
+	claims := []*corev1.PersistentVolumeClaim{{}, {}}
+	claims[0].Name = baremetalImageCacheClaimName
+	claims[0].Status.Phase = corev1.ClaimBound
+	claims[1].Name = baremetalDatabaseClaimName
+	claims[1].Status.Phase = corev1.ClaimPending
+
+	setStorageConditions(instance, claims)
+	progressing := v1helpers.FindOperatorCondition(instance.Status.Conditions, provisioningStorageProgressing)
+	if progressing == nil || progressing.Reason != reasonClaimPending {
+		t.Errorf("Expected %s with reason %s, got %+v", provisioningStorageProgressing, reasonClaimPending, progressing)
+	}
+	if !v1helpers.IsOperatorConditionFalse(instance.Status.Conditions, provisioningStorageDegraded) {
+		t.Errorf("Expected %s to be False, got %+v", provisioningStorageDegraded, instance.Status.Conditions)
+	}
+
+	claims[1].Status.Phase = corev1.ClaimLost
+	setStorageConditions(instance, claims)
+	degraded := v1helpers.FindOperatorCondition(instance.Status.Conditions, provisioningStorageDegraded)
+	if degraded == nil || degraded.Reason != reasonClaimLost {
+		t.Errorf("Expected %s with reason %s, got %+v", provisioningStorageDegraded, reasonClaimLost, degraded)
+	}
+	if !v1helpers.IsOperatorConditionFalse(instance.Status.Conditions, provisioningStorageProgressing) {
+		t.Errorf("Expected %s to be False, got %+v", provisioningStorageProgressing, instance.Status.Conditions)
+	}
+}
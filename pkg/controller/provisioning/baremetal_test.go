@@ -1,9 +1,22 @@
 package provisioning
 
 import (
+	"reflect"
 	"testing"
 
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	appsclientv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
 	metal3v1alpha1 "github.com/openshift/cluster-baremetal-operator/pkg/apis/metal3/v1alpha1"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/resource/resourcemerge"
 )
 
 var provisioningCR = &metal3v1alpha1.Provisioning{
@@ -22,35 +35,64 @@ var (
 	expectedProvisioningNetworkCIDR  = "172.30.20.0/24"
 	expectedProvisioningDHCPExternal = false
 	expectedProvisioningDHCPRange    = "172.30.20.11, 172.30.20.101"
+	expectedDnsmasqDHCPRange         = "172.30.20.11,172.30.20.101"
 	expectedOSImageURL               = "http://172.22.0.1/images/rhcos-44.81.202001171431.0-openstack.x86_64.qcow2.gz?sha256=e98f83a2b9d4043719664a2be75fe8134dc6ca1fdbde807996622f8cc7ecd234"
 	expectedProvisioningIPCIDR       = "172.30.20.3/24"
 	expectedDeployKernelURL          = "http://172.30.20.3:6180/images/ironic-python-agent.kernel"
 	expectedDeployRamdiskURL         = "http://172.30.20.3:6180/images/ironic-python-agent.initramfs"
-	expectedIronicEndpoint           = "http://172.30.20.3:6385/v1/"
-	expectedIronicInspectorEndpoint  = "http://172.30.20.3:5050/v1/"
+	expectedIronicEndpoint           = "https://172.30.20.3:6385/v1/"
+	expectedIronicInspectorEndpoint  = "https://172.30.20.3:5050/v1/"
 	expectedHttpPort                 = "6180"
 )
 
 func TestGenerateRandomPassword(t *testing.T) {
-	pwd := generateRandomPassword()
-	if pwd == "" {
-		t.Errorf("Expected a valid string but got null")
+	for _, length := range []int{16, 32} {
+		pwd, err := generateRandomPassword(length)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(pwd) != length {
+			t.Errorf("Expected a password of length %d but got %q", length, pwd)
+		}
+	}
+}
+
+func TestGetMariadbPasswordLength(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected int
+	}{
+		{value: "", expected: defaultMariadbPasswordLength},
+		{value: "32", expected: 32},
+		{value: "8", expected: defaultMariadbPasswordLength},
+		{value: "long", expected: defaultMariadbPasswordLength},
+	}
+	for _, tc := range testCases {
+		if actual := getMariadbPasswordLength(tc.value); actual != tc.expected {
+			t.Errorf("Expected length %d for %q, got %d", tc.expected, tc.value, actual)
+		}
 	}
 }
 
 // Testing the mariadb password creation
 func TestCreateMariadbPasswordSecret(t *testing.T) {
-	operatorConfig := &OperatorConfig{TargetNamespace: "test-namespace"}
+	operatorConfig := &OperatorConfig{TargetNamespace: "test-namespace", MariadbPasswordLength: defaultMariadbPasswordLength}
 
 	// First create a mariadb password secret
-	oldMariadbPassword := createMariadbPasswordSecret(operatorConfig)
+	oldMariadbPassword, err := createMariadbPasswordSecret(operatorConfig, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 	oldPassword, ok := oldMariadbPassword.StringData[baremetalSecretKey]
 	if !ok || oldPassword == "" {
 		t.Fatal("Failure reading first Mariadb password from Secret.")
 	}
 
 	// Create another mariadb password secret
-	newMariadbPassword := createMariadbPasswordSecret(operatorConfig)
+	newMariadbPassword, err := createMariadbPasswordSecret(operatorConfig, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 	newPassword, ok := newMariadbPassword.StringData[baremetalSecretKey]
 	if !ok || newPassword == "" {
 		t.Fatal("Failure reading second Mariadb password from Secret.")
@@ -60,6 +102,236 @@ func TestCreateMariadbPasswordSecret(t *testing.T) {
 	}
 }
 
+func TestRotatePassword(t *testing.T) {
+	operatorConfig := &OperatorConfig{TargetNamespace: "test-namespace", MariadbPasswordLength: defaultMariadbPasswordLength}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: baremetalSecretName, Namespace: "test-namespace"},
+		Data:       map[string][]byte{baremetalSecretKey: []byte("old-password")},
+	}
+
+	// Without the annotation, nothing changes
+	rotated, err := rotatePassword(operatorConfig, secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rotated || string(secret.Data[baremetalSecretKey]) != "old-password" {
+		t.Errorf("Expected no rotation, got Secret %+v", secret)
+	}
+
+	secret.Annotations = map[string]string{passwordRotateAnnotation: ""}
+	rotated, err = rotatePassword(operatorConfig, secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !rotated {
+		t.Fatal("Expected the password to be rotated")
+	}
+	if password := string(secret.Data[baremetalSecretKey]); password == "old-password" || len(password) != defaultMariadbPasswordLength {
+		t.Errorf("Expected a new password, got %q", password)
+	}
+	if _, ok := secret.Annotations[passwordRotateAnnotation]; ok {
+		t.Errorf("Expected the rotation request to be removed, got %v", secret.Annotations)
+	}
+	if _, ok := secret.Annotations[passwordRotatedAtAnnotation]; !ok {
+		t.Errorf("Expected the rotation time to be recorded, got %v", secret.Annotations)
+	}
+
+	// The API passwords keep their own length
+	secret.Name = baremetalIronicSecretName
+	secret.Annotations = map[string]string{passwordRotateAnnotation: ""}
+	if _, err := rotatePassword(operatorConfig, secret); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if password := string(secret.Data[baremetalSecretKey]); len(password) != ironicPasswordLength {
+		t.Errorf("Expected a new password of %d characters, got %q", ironicPasswordLength, password)
+	}
+}
+
+func TestMariadbContainer(t *testing.T) {
+	operatorConfig := &OperatorConfig{TargetNamespace: "test-namespace"}
+	baremetalConfig := getBaremetalProvisioningConfig(provisioningCR)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: baremetalSecretName, Namespace: "test-namespace"},
+		Data:       map[string][]byte{baremetalSecretKey: []byte("password")},
+	}
+	newMariadbPod := func() (*corev1.PodTemplateSpec, *corev1.Container) {
+		template := newMetal3PodTemplateSpec(operatorConfig, baremetalConfig, []*corev1.Secret{secret})
+		for i, container := range template.Spec.Containers {
+			if container.Name == "metal3-mariadb" {
+				return template, &template.Spec.Containers[i]
+			}
+		}
+		t.Fatalf("Expected a metal3-mariadb container")
+		return nil, nil
+	}
+	template, container := newMariadbPod()
+
+	// A failing lifecycle hook would get the container killed, so the
+	// password is set from the startup command instead
+	if container.Lifecycle != nil {
+		t.Errorf("Expected no lifecycle hooks, got %+v", container.Lifecycle)
+	}
+	if expected := []string{"/bin/sh", "-c", mariadbStartScript}; !reflect.DeepEqual(container.Command, expected) {
+		t.Errorf("Expected MariaDB to be started by mariadbStartScript, got %v", container.Command)
+	}
+	expectedEnv := []corev1.EnvVar{
+		{
+			Name: "MARIADB_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: baremetalSecretName},
+					Key:                  baremetalSecretKey,
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(container.Env, expectedEnv) {
+		t.Errorf("Expected the password to be read from the Secret, got %+v", container.Env)
+	}
+
+	// A rotated password rolls out a new pod, whose startup command sets it
+	secretAnnotation := secretHashAnnotationPrefix + baremetalSecretName
+	previousHash := template.Annotations[secretAnnotation]
+	if previousHash == "" {
+		t.Fatalf("Expected a hash of the password Secret, got %v", template.Annotations)
+	}
+	secret.Annotations = map[string]string{passwordRotateAnnotation: ""}
+	if rotated, err := rotatePassword(operatorConfig, secret); err != nil || !rotated {
+		t.Fatalf("Expected the password to be rotated, got %v, %v", rotated, err)
+	}
+	template, _ = newMariadbPod()
+	if hash := template.Annotations[secretAnnotation]; hash == "" || hash == previousHash {
+		t.Errorf("Expected the hash of the password Secret to change from %s, got %s", previousHash, hash)
+	}
+}
+
+func TestMetal3PodAnnotations(t *testing.T) {
+	operatorConfig := &OperatorConfig{TargetNamespace: "test-namespace"}
+	baremetalConfig := getBaremetalProvisioningConfig(provisioningCR)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: baremetalSecretName, Namespace: "test-namespace"},
+		StringData: map[string]string{baremetalSecretKey: "password"},
+	}
+	secretAnnotation := secretHashAnnotationPrefix + baremetalSecretName
+	configMapAnnotation := configMapHashAnnotationPrefix + baremetalConfigmap
+
+	annotations := newMetal3PodTemplateSpec(operatorConfig, baremetalConfig, []*corev1.Secret{secret}).Annotations
+	if annotations[secretAnnotation] == "" || annotations[configMapAnnotation] == "" {
+		t.Fatalf("Expected hashes of the Secret and ConfigMap, got %v", annotations)
+	}
+
+	// The Secret read back from the API server holds the same contents
+	// in Data, which must not roll out a new pod
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: baremetalSecretName, Namespace: "test-namespace"},
+		Data:       map[string][]byte{baremetalSecretKey: []byte("password")},
+	}
+	unchanged := newMetal3PodTemplateSpec(operatorConfig, baremetalConfig, []*corev1.Secret{secret}).Annotations
+	if !reflect.DeepEqual(annotations, unchanged) {
+		t.Errorf("Expected the annotations to be unchanged, got %v and %v", annotations, unchanged)
+	}
+
+	// Changing the password or the configuration changes the template
+	secret.Data[baremetalSecretKey] = []byte("new-password")
+	changed := newMetal3PodTemplateSpec(operatorConfig, baremetalConfig, []*corev1.Secret{secret}).Annotations
+	if changed[secretAnnotation] == annotations[secretAnnotation] || changed[configMapAnnotation] != annotations[configMapAnnotation] {
+		t.Errorf("Expected only the Secret hash to change, got %v and %v", annotations, changed)
+	}
+	baremetalConfig.ProvisioningOSDownloadURL = "http://example.com/other-image.qcow2"
+	changed = newMetal3PodTemplateSpec(operatorConfig, baremetalConfig, []*corev1.Secret{secret}).Annotations
+	if changed[configMapAnnotation] == annotations[configMapAnnotation] {
+		t.Errorf("Expected the ConfigMap hash to change, got %v", changed)
+	}
+}
+
+// fakeDeployments stores Deployments in memory, bumping their generation
+// when their spec changes, like the API server. Other methods of the
+// client are not implemented.
+type fakeDeployments struct {
+	appsclientv1.DeploymentInterface
+	deployments map[string]*appsv1.Deployment
+	writes      int
+}
+
+func (f *fakeDeployments) Deployments(namespace string) appsclientv1.DeploymentInterface {
+	return f
+}
+
+func (f *fakeDeployments) Get(name string, options metav1.GetOptions) (*appsv1.Deployment, error) {
+	deployment, ok := f.deployments[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Group: "apps", Resource: "deployments"}, name)
+	}
+	return deployment.DeepCopy(), nil
+}
+
+func (f *fakeDeployments) Create(deployment *appsv1.Deployment) (*appsv1.Deployment, error) {
+	deployment = deployment.DeepCopy()
+	deployment.Generation = 1
+	f.deployments[deployment.Name] = deployment
+	f.writes++
+	return deployment.DeepCopy(), nil
+}
+
+func (f *fakeDeployments) Update(deployment *appsv1.Deployment) (*appsv1.Deployment, error) {
+	deployment = deployment.DeepCopy()
+	if !reflect.DeepEqual(deployment.Spec, f.deployments[deployment.Name].Spec) {
+		deployment.Generation++
+	}
+	f.deployments[deployment.Name] = deployment
+	f.writes++
+	return deployment.DeepCopy(), nil
+}
+
+func TestApplyMetal3Deployment(t *testing.T) {
+	operatorConfig := &OperatorConfig{TargetNamespace: "test-namespace"}
+	baremetalConfig := getBaremetalProvisioningConfig(provisioningCR)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: baremetalSecretName, Namespace: "test-namespace"},
+		Data:       map[string][]byte{baremetalSecretKey: []byte("password")},
+	}
+	client := &fakeDeployments{deployments: map[string]*appsv1.Deployment{}}
+	generations := []operatorv1.GenerationStatus{}
+
+	// apply mirrors the reconcile of the metal3 Deployment
+	apply := func(hashSpec bool) {
+		deployment := newMetal3Deployment(operatorConfig, baremetalConfig, []*corev1.Secret{secret})
+		if hashSpec {
+			if err := setSpecHashAnnotation(deployment); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		expectedGeneration := resourcemerge.ExpectedDeploymentGeneration(deployment, generations)
+		actual, _, err := resourceapply.ApplyDeployment(client, events.NewInMemoryRecorder("test"), deployment, expectedGeneration, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		resourcemerge.SetDeploymentGeneration(&generations, actual)
+	}
+
+	apply(true)
+	apply(true)
+	if client.writes != 1 {
+		t.Fatalf("Expected an unchanged Deployment to be written once, got %d writes", client.writes)
+	}
+
+	// A new password only changes the pod template, which ApplyDeployment
+	// ignores unless the metadata of the Deployment changes too
+	secret.Data[baremetalSecretKey] = []byte("new-password")
+	apply(false)
+	if client.writes != 1 {
+		t.Fatalf("Expected ApplyDeployment to skip a change to the pod template alone, got %d writes", client.writes)
+	}
+	apply(true)
+	if client.writes != 2 {
+		t.Errorf("Expected the changed pod template to be written, got %d writes", client.writes)
+	}
+	written := client.deployments[baremetalDeploymentName].Spec.Template.Annotations[secretHashAnnotationPrefix+baremetalSecretName]
+	if written != secretContentHash(secret) {
+		t.Errorf("Expected the new Secret hash to be written, got %q", written)
+	}
+}
+
 func TestGetBaremetalProvisioningConfig(t *testing.T) {
 	baremetalConfig := getBaremetalProvisioningConfig(provisioningCR)
 	if baremetalConfig.ProvisioningInterface != expectedProvisioningInterface ||
@@ -151,11 +423,583 @@ func TestGetMetal3DeploymentConfig(t *testing.T) {
 	}
 	actualDHCPRange := getMetal3DeploymentConfig("DHCP_RANGE", baremetalConfig)
 	if actualDHCPRange != nil {
-		t.Logf("Actual DHCP Range is %s, Expected is %s", *actualDHCPRange, expectedProvisioningDHCPRange)
-		if *actualDHCPRange != expectedProvisioningDHCPRange {
-			t.Errorf("Actual %s and Expected %s DHCP Range do not match", *actualDHCPRange, expectedProvisioningDHCPRange)
+		t.Logf("Actual DHCP Range is %s, Expected is %s", *actualDHCPRange, expectedDnsmasqDHCPRange)
+		if *actualDHCPRange != expectedDnsmasqDHCPRange {
+			t.Errorf("Actual %s and Expected %s DHCP Range do not match", *actualDHCPRange, expectedDnsmasqDHCPRange)
 		}
 	} else {
 		t.Errorf("Provisioning DHCP Range is not available.")
 	}
 }
+
+func TestGetDefaultDHCPRange(t *testing.T) {
+	tCases := []struct {
+		name          string
+		cidr          string
+		ip            string
+		expectedRange string
+	}{
+		{
+			name:          "IPv4",
+			cidr:          "172.30.20.0/24",
+			ip:            "172.30.20.3",
+			expectedRange: "172.30.20.10,172.30.20.100",
+		},
+		{
+			name:          "IPv4LargeNetwork",
+			cidr:          "10.0.0.0/8",
+			ip:            "10.0.0.3",
+			expectedRange: "10.0.0.10,10.0.0.100",
+		},
+		{
+			name:          "IPv4ProvisioningIPInRange",
+			cidr:          "172.30.20.0/24",
+			ip:            "172.30.20.20",
+			expectedRange: "172.30.20.21,172.30.20.100",
+		},
+		{
+			name:          "IPv4ProvisioningIPNearEnd",
+			cidr:          "172.30.20.0/24",
+			ip:            "172.30.20.90",
+			expectedRange: "172.30.20.10,172.30.20.89",
+		},
+		{
+			name:          "IPv4SmallNetwork",
+			cidr:          "192.168.1.64/26",
+			ip:            "192.168.1.65",
+			expectedRange: "192.168.1.74,192.168.1.126",
+		},
+		{
+			name:          "IPv4TinyNetwork",
+			cidr:          "192.168.1.8/29",
+			ip:            "192.168.1.9",
+			expectedRange: "192.168.1.10,192.168.1.14",
+		},
+		{
+			name:          "IPv4SlashThirty",
+			cidr:          "192.168.1.4/30",
+			ip:            "192.168.1.5",
+			expectedRange: "192.168.1.6,192.168.1.6",
+		},
+		{
+			name: "IPv4SlashThirtyOne",
+			cidr: "192.168.1.4/31",
+			ip:   "192.168.1.5",
+		},
+		{
+			name:          "IPv6",
+			cidr:          "fd00:1101::/64",
+			ip:            "fd00:1101::3",
+			expectedRange: "fd00:1101::a,fd00:1101::64,64",
+		},
+		{
+			name:          "IPv6SmallNetwork",
+			cidr:          "fd00:1101::/120",
+			ip:            "fd00:1101::20",
+			expectedRange: "fd00:1101::21,fd00:1101::64,120",
+		},
+		{
+			name:          "IPv6TinyNetwork",
+			cidr:          "fd00:1101::/125",
+			ip:            "fd00:1101::1",
+			expectedRange: "fd00:1101::2,fd00:1101::7,125",
+		},
+	}
+
+	for _, tc := range tCases {
+		t.Run(tc.name, func(t *testing.T) {
+			baremetalConfig := BaremetalProvisioningConfig{
+				ProvisioningIp:          tc.ip,
+				ProvisioningNetworkCIDR: tc.cidr,
+				ProvisioningNetwork:     metal3v1alpha1.ProvisioningNetworkManaged,
+			}
+			actualRange := getMetal3DeploymentConfig("DHCP_RANGE", baremetalConfig)
+			if tc.expectedRange == "" {
+				if actualRange != nil {
+					t.Errorf("Expected no DHCP range, got %s", *actualRange)
+				}
+				return
+			}
+			if actualRange == nil {
+				t.Fatalf("Expected DHCP range %s, got none", tc.expectedRange)
+			}
+			if *actualRange != tc.expectedRange {
+				t.Errorf("Actual %s and Expected %s DHCP Range do not match", *actualRange, tc.expectedRange)
+			}
+		})
+	}
+}
+
+func TestGetMetal3DeploymentConfigIPv6(t *testing.T) {
+	baremetalConfig := BaremetalProvisioningConfig{
+		ProvisioningInterface:   "ensp0",
+		ProvisioningIp:          "fd00:1101::3",
+		ProvisioningNetworkCIDR: "fd00:1101::/64",
+		ProvisioningDHCPRange:   "fd00:1101::10, fd00:1101::100",
+		ProvisioningNetwork:     metal3v1alpha1.ProvisioningNetworkManaged,
+	}
+	expectedConfig := map[string]string{
+		"PROVISIONING_IP":           "fd00:1101::3/64",
+		"DEPLOY_KERNEL_URL":         "http://[fd00:1101::3]:6180/images/ironic-python-agent.kernel",
+		"DEPLOY_RAMDISK_URL":        "http://[fd00:1101::3]:6180/images/ironic-python-agent.initramfs",
+		"IRONIC_ENDPOINT":           "https://[fd00:1101::3]:6385/v1/",
+		"IRONIC_INSPECTOR_ENDPOINT": "https://[fd00:1101::3]:5050/v1/",
+		"DHCP_RANGE":                "fd00:1101::10,fd00:1101::100,64",
+	}
+	for name, expected := range expectedConfig {
+		actual := getMetal3DeploymentConfig(name, baremetalConfig)
+		if actual == nil {
+			t.Errorf("%s is not available.", name)
+		} else if *actual != expected {
+			t.Errorf("Actual %s and Expected %s %s do not match", *actual, expected, name)
+		}
+	}
+
+	tCases := []struct {
+		mode          metal3v1alpha1.IPv6AddressMode
+		expectedRange string
+	}{
+		{mode: metal3v1alpha1.IPv6AddressModeDHCPv6Stateful, expectedRange: "fd00:1101::10,fd00:1101::100,64"},
+		{mode: metal3v1alpha1.IPv6AddressModeDHCPv6Stateless, expectedRange: "fd00:1101::,ra-stateless,64"},
+		{mode: metal3v1alpha1.IPv6AddressModeSLAAC, expectedRange: "fd00:1101::,ra-only,64"},
+	}
+	for _, tc := range tCases {
+		baremetalConfig.ProvisioningIPv6AddressMode = tc.mode
+		actualRange := getMetal3DeploymentConfig("DHCP_RANGE", baremetalConfig)
+		if actualRange == nil || *actualRange != tc.expectedRange {
+			t.Errorf("Expected DHCP Range %s in %s mode, got %v", tc.expectedRange, tc.mode, actualRange)
+		}
+	}
+}
+
+func TestDualStackContainers(t *testing.T) {
+	baremetalConfig := getBaremetalProvisioningConfig(provisioningCR)
+	baremetalConfig.ProvisioningSecondaryIp = "fd00:1101::3"
+	baremetalConfig.ProvisioningSecondaryNetworkCIDR = "fd00:1101::/64"
+
+	expectedEnv := map[string]map[string]string{
+		"metal3-dnsmasq": {
+			"DHCP_RANGE":           "172.30.20.11,172.30.20.101",
+			"SECONDARY_DHCP_RANGE": "fd00:1101::a,fd00:1101::64,64",
+		},
+	}
+	// Every container configuring, binding to or advertising the
+	// provisioning IP gets the address of each IP family
+	for _, name := range []string{"metal3-static-ip-manager", "metal3-httpd", "metal3-ironic-conductor", "metal3-ironic-api"} {
+		expectedEnv[name] = map[string]string{
+			"PROVISIONING_IP":           "172.30.20.3/24",
+			"PROVISIONING_SECONDARY_IP": "fd00:1101::3/64",
+		}
+	}
+	configMap := newMetal3ConfigMap(&OperatorConfig{}, baremetalConfig)
+	containers := newMetal3Containers(&OperatorConfig{}, baremetalConfig)
+	for _, container := range containers {
+		expected, ok := expectedEnv[container.Name]
+		if !ok {
+			continue
+		}
+		for name, value := range expected {
+			found := false
+			for _, env := range container.Env {
+				if env.Name == name {
+					found = true
+					actual := configMap.Data[env.ValueFrom.ConfigMapKeyRef.Key]
+					if actual != value {
+						t.Errorf("Container %s: expected %s=%s, got %s", container.Name, name, value, actual)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("Container %s: %s is not set", container.Name, name)
+			}
+		}
+	}
+}
+
+func TestNewMetal3ConfigMap(t *testing.T) {
+	operatorConfig := &OperatorConfig{TargetNamespace: "test-namespace"}
+	baremetalConfig := getBaremetalProvisioningConfig(provisioningCR)
+	configMap := newMetal3ConfigMap(operatorConfig, baremetalConfig)
+	if configMap.Name != baremetalConfigmap || configMap.Namespace != operatorConfig.TargetNamespace {
+		t.Errorf("Unexpected ConfigMap %s/%s", configMap.Namespace, configMap.Name)
+	}
+
+	expectedData := map[string]string{
+		"provisioning_ip":           expectedProvisioningIPCIDR,
+		"provisioning_interface":    expectedProvisioningInterface,
+		"deploy_kernel_url":         expectedDeployKernelURL,
+		"deploy_ramdisk_url":        expectedDeployRamdiskURL,
+		"ironic_endpoint":           expectedIronicEndpoint,
+		"ironic_inspector_endpoint": expectedIronicInspectorEndpoint,
+		"http_port":                 expectedHttpPort,
+		"dhcp_range":                expectedDnsmasqDHCPRange,
+		"rhcos_image_url":           expectedOSImageURL,
+	}
+	for key, expected := range expectedData {
+		if actual := configMap.Data[key]; actual != expected {
+			t.Errorf("Actual %s and Expected %s %s do not match", actual, expected, key)
+		}
+	}
+
+	// Every ConfigMap reference of the metal3 pod must resolve
+	template := newMetal3PodTemplateSpec(operatorConfig, baremetalConfig, nil)
+	containers := append(template.Spec.InitContainers, template.Spec.Containers...)
+	for _, container := range containers {
+		for _, env := range container.Env {
+			if env.ValueFrom == nil || env.ValueFrom.ConfigMapKeyRef == nil {
+				continue
+			}
+			ref := env.ValueFrom.ConfigMapKeyRef
+			if ref.Name != baremetalConfigmap {
+				t.Errorf("Container %s: %s refers to ConfigMap %s", container.Name, env.Name, ref.Name)
+			} else if _, ok := configMap.Data[ref.Key]; !ok {
+				t.Errorf("Container %s: %s refers to missing key %s", container.Name, env.Name, ref.Key)
+			}
+		}
+	}
+}
+
+func TestProvisioningNetworkModes(t *testing.T) {
+	tCases := []struct {
+		name                   string
+		mode                   metal3v1alpha1.ProvisioningNetwork
+		dhcpExternal           bool
+		expectedContainers     []string
+		expectedMissing        []string
+		expectedBootInterface  string
+		expectedBootInterfaces string
+	}{
+		{
+			name:                   "Default",
+			expectedContainers:     []string{"metal3-static-ip-set", "metal3-dnsmasq", "metal3-static-ip-manager"},
+			expectedBootInterface:  "ipxe",
+			expectedBootInterfaces: "ipxe,pxe,redfish-virtual-media",
+		},
+		{
+			name:                   "DHCPExternal",
+			dhcpExternal:           true,
+			expectedContainers:     []string{"metal3-static-ip-set", "metal3-static-ip-manager"},
+			expectedMissing:        []string{"metal3-dnsmasq"},
+			expectedBootInterface:  "ipxe",
+			expectedBootInterfaces: "ipxe,pxe,redfish-virtual-media",
+		},
+		{
+			name:                   "Managed",
+			mode:                   metal3v1alpha1.ProvisioningNetworkManaged,
+			expectedContainers:     []string{"metal3-static-ip-set", "metal3-dnsmasq", "metal3-static-ip-manager"},
+			expectedBootInterface:  "ipxe",
+			expectedBootInterfaces: "ipxe,pxe,redfish-virtual-media",
+		},
+		{
+			name:                   "Unmanaged",
+			mode:                   metal3v1alpha1.ProvisioningNetworkUnmanaged,
+			expectedContainers:     []string{"metal3-static-ip-set", "metal3-static-ip-manager"},
+			expectedMissing:        []string{"metal3-dnsmasq"},
+			expectedBootInterface:  "ipxe",
+			expectedBootInterfaces: "ipxe,pxe,redfish-virtual-media",
+		},
+		{
+			name:                   "Disabled",
+			mode:                   metal3v1alpha1.ProvisioningNetworkDisabled,
+			expectedMissing:        []string{"metal3-static-ip-set", "metal3-dnsmasq", "metal3-static-ip-manager"},
+			expectedBootInterface:  "redfish-virtual-media",
+			expectedBootInterfaces: "redfish-virtual-media",
+		},
+	}
+
+	for _, tc := range tCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := provisioningCR.DeepCopy()
+			cr.Spec.ProvisioningNetwork = tc.mode
+			cr.Spec.ProvisioningDHCPExternal = tc.dhcpExternal
+			baremetalConfig := getBaremetalProvisioningConfig(cr)
+
+			template := newMetal3PodTemplateSpec(&OperatorConfig{}, baremetalConfig, nil)
+			names := map[string]bool{}
+			for _, container := range append(template.Spec.InitContainers, template.Spec.Containers...) {
+				names[container.Name] = true
+			}
+			for _, name := range tc.expectedContainers {
+				if !names[name] {
+					t.Errorf("Expected container %s in %s mode", name, baremetalConfig.ProvisioningNetwork)
+				}
+			}
+			for _, name := range tc.expectedMissing {
+				if names[name] {
+					t.Errorf("Unexpected container %s in %s mode", name, baremetalConfig.ProvisioningNetwork)
+				}
+			}
+
+			configMap := newMetal3ConfigMap(&OperatorConfig{}, baremetalConfig)
+			if actual := configMap.Data["default_boot_interface"]; actual != tc.expectedBootInterface {
+				t.Errorf("Actual %s and Expected %s default boot interface do not match", actual, tc.expectedBootInterface)
+			}
+			if actual := configMap.Data["enabled_boot_interfaces"]; actual != tc.expectedBootInterfaces {
+				t.Errorf("Actual %s and Expected %s enabled boot interfaces do not match", actual, tc.expectedBootInterfaces)
+			}
+		})
+	}
+}
+
+func TestVirtualMediaViaExternalNetwork(t *testing.T) {
+	operatorConfig := &OperatorConfig{TargetNamespace: "test-namespace"}
+	route := newMetal3ImageRoute(operatorConfig)
+	if externalHttpURL := getExternalHttpURL(route); externalHttpURL != nil {
+		t.Errorf("Expected no external URL before a host is assigned, got %s", *externalHttpURL)
+	}
+	route.Spec.Host = "metal3-image-endpoint-openshift-machine-api.apps.example.com"
+	externalHttpURL := getExternalHttpURL(route)
+	if externalHttpURL == nil || *externalHttpURL != "http://metal3-image-endpoint-openshift-machine-api.apps.example.com/" {
+		t.Fatalf("Unexpected external URL %v", externalHttpURL)
+	}
+
+	cr := provisioningCR.DeepCopy()
+	baremetalConfig := getBaremetalProvisioningConfig(cr)
+	baremetalConfig.ExternalHttpURL = *externalHttpURL
+	if actual := newMetal3ConfigMap(operatorConfig, baremetalConfig).Data["external_http_url"]; actual != "" {
+		t.Errorf("Expected no external URL without virtualMediaViaExternalNetwork, got %s", actual)
+	}
+
+	cr.Spec.VirtualMediaViaExternalNetwork = true
+	baremetalConfig = getBaremetalProvisioningConfig(cr)
+	baremetalConfig.ExternalHttpURL = *externalHttpURL
+	if actual := newMetal3ConfigMap(operatorConfig, baremetalConfig).Data["external_http_url"]; actual != *externalHttpURL {
+		t.Errorf("Actual %s and Expected %s external URLs do not match", actual, *externalHttpURL)
+	}
+
+	// The Service must select the metal3 pod and its httpd port
+	service := newMetal3ImageService(operatorConfig)
+	template := newMetal3PodTemplateSpec(operatorConfig, baremetalConfig, nil)
+	for key, value := range service.Spec.Selector {
+		if template.Labels[key] != value {
+			t.Errorf("Service selector %s=%s does not match the metal3 pod", key, value)
+		}
+	}
+	found := false
+	for _, container := range template.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == service.Spec.Ports[0].TargetPort.StrVal {
+				found = container.Name == "metal3-httpd"
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Service target port %s is not served by metal3-httpd", service.Spec.Ports[0].TargetPort.StrVal)
+	}
+}
+
+func TestMetal3Authentication(t *testing.T) {
+	operatorConfig := &OperatorConfig{TargetNamespace: "test-namespace", MariadbPasswordLength: defaultMariadbPasswordLength}
+	baremetalConfig := getBaremetalProvisioningConfig(provisioningCR)
+	template := newMetal3PodTemplateSpec(operatorConfig, baremetalConfig, nil)
+	configMap := newMetal3ConfigMap(operatorConfig, baremetalConfig)
+
+	secret, err := createIronicCredentialsSecret(operatorConfig, baremetalIronicSecretName, ironicUsername, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if secret.StringData[baremetalUsernameKey] != ironicUsername || len(secret.StringData[baremetalSecretKey]) != ironicPasswordLength {
+		t.Errorf("Unexpected credentials %v", secret.StringData)
+	}
+
+	// Every Secret the pod consumes is hashed into its template
+	hashedSecrets := map[string]bool{}
+	for _, name := range metal3PodSecrets {
+		hashedSecrets[name] = true
+	}
+	for _, volume := range template.Spec.Volumes {
+		if volume.Secret != nil && !hashedSecrets[volume.Secret.SecretName] {
+			t.Errorf("Secret %s of volume %s is not in metal3PodSecrets", volume.Secret.SecretName, volume.Name)
+		}
+	}
+
+	containers := map[string]corev1.Container{}
+	for _, container := range append(template.Spec.InitContainers, template.Spec.Containers...) {
+		containers[container.Name] = container
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil && !hashedSecrets[env.ValueFrom.SecretKeyRef.Name] {
+				t.Errorf("Secret %s of %s in %s is not in metal3PodSecrets", env.ValueFrom.SecretKeyRef.Name, env.Name, container.Name)
+			}
+		}
+	}
+	if _, ok := containers["metal3-htpasswd-generator"]; !ok {
+		t.Errorf("Expected an init container generating the htpasswd files")
+	}
+
+	// Both APIs require HTTP basic auth, and their clients have credentials
+	expectedEnv := map[string]map[string]string{
+		"metal3-ironic-api": {
+			"OS_DEFAULT__AUTH_STRATEGY":             baremetalHttpBasicAuth,
+			"OS_DEFAULT__HTTP_BASIC_AUTH_USER_FILE": "/auth/htpasswd",
+		},
+		"metal3-ironic-inspector": {
+			"OS_DEFAULT__AUTH_STRATEGY":             baremetalHttpBasicAuth,
+			"OS_DEFAULT__HTTP_BASIC_AUTH_USER_FILE": "/auth/htpasswd",
+			"OS_IRONIC__AUTH_TYPE":                  baremetalHttpBasicAuth,
+			"OS_IRONIC__USERNAME":                   baremetalIronicSecretName,
+			"OS_IRONIC__PASSWORD":                   baremetalIronicSecretName,
+		},
+		"metal3-ironic-conductor": {
+			"OS_INSPECTOR__AUTH_TYPE": baremetalHttpBasicAuth,
+			"OS_INSPECTOR__USERNAME":  baremetalIronicInspectorSecretName,
+			"OS_INSPECTOR__PASSWORD":  baremetalIronicInspectorSecretName,
+		},
+	}
+	for name, expected := range expectedEnv {
+		container := containers[name]
+		for envName, value := range expected {
+			found := false
+			for _, env := range container.Env {
+				if env.Name != envName {
+					continue
+				}
+				found = true
+				actual := ""
+				if env.ValueFrom.SecretKeyRef != nil {
+					actual = env.ValueFrom.SecretKeyRef.Name
+				} else {
+					actual = configMap.Data[env.ValueFrom.ConfigMapKeyRef.Key]
+				}
+				if actual != value {
+					t.Errorf("Expected %s of %s to be %s, got %s", envName, name, value, actual)
+				}
+			}
+			if !found {
+				t.Errorf("Expected %s in %s", envName, name)
+			}
+		}
+	}
+
+	mounts := map[string]string{}
+	for _, mount := range containers["metal3-baremetal-operator"].VolumeMounts {
+		mounts[mount.Name] = mount.MountPath
+	}
+	if mounts[baremetalIronicSecretName] != "/opt/metal3/auth/ironic" || mounts[baremetalIronicInspectorSecretName] != "/opt/metal3/auth/ironic-inspector" {
+		t.Errorf("Expected the credentials to be mounted into metal3-baremetal-operator, got %v", mounts)
+	}
+}
+
+func TestSplitWorkloadLayout(t *testing.T) {
+	operatorConfig := &OperatorConfig{TargetNamespace: "test-namespace"}
+	instance := provisioningCR.DeepCopy()
+	instance.Spec.WorkloadLayout = metal3v1alpha1.WorkloadLayoutSplit
+	baremetalConfig := getBaremetalProvisioningConfig(instance)
+	secrets := []*corev1.Secret{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: baremetalSecretName, Namespace: "test-namespace"},
+			StringData: map[string]string{baremetalSecretKey: "password"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: baremetalIronicSecretName, Namespace: "test-namespace"},
+			StringData: map[string]string{baremetalUsernameKey: ironicUsername, baremetalSecretKey: "password"},
+		},
+	}
+
+	metal3Deployment := newMetal3Deployment(operatorConfig, baremetalConfig, secrets)
+	operatorDeployment := newBaremetalOperatorDeployment(operatorConfig, baremetalConfig, secrets)
+
+	for _, container := range metal3Deployment.Spec.Template.Spec.Containers {
+		if container.Name == "metal3-baremetal-operator" {
+			t.Errorf("Expected the baremetal-operator not to run in the metal3 pod")
+		}
+	}
+	containers := operatorDeployment.Spec.Template.Spec.Containers
+	if len(containers) != 1 || containers[0].Name != "metal3-baremetal-operator" {
+		t.Errorf("Expected the baremetal-operator alone in its pod, got %d containers", len(containers))
+	}
+
+	// Neither Deployment selects the pods of the other
+	metal3Selector := labels.SelectorFromSet(metal3Deployment.Spec.Selector.MatchLabels)
+	operatorSelector := labels.SelectorFromSet(operatorDeployment.Spec.Selector.MatchLabels)
+	if metal3Selector.Matches(labels.Set(operatorDeployment.Spec.Template.Labels)) ||
+		operatorSelector.Matches(labels.Set(metal3Deployment.Spec.Template.Labels)) {
+		t.Errorf("Expected the selectors not to overlap, got %v and %v", metal3Selector, operatorSelector)
+	}
+
+	// The baremetal-operator runs next to Ironic, which it reaches at the
+	// provisioning IP of that node
+	affinity := operatorDeployment.Spec.Template.Spec.Affinity
+	if affinity == nil || affinity.PodAffinity == nil || len(affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution) != 1 {
+		t.Fatalf("Expected the baremetal-operator to require the node of the metal3 pod, got %+v", affinity)
+	}
+	term := affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution[0]
+	affinitySelector, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if term.TopologyKey != "kubernetes.io/hostname" || !affinitySelector.Matches(labels.Set(metal3Deployment.Spec.Template.Labels)) {
+		t.Errorf("Expected the baremetal-operator to run on the node of the metal3 pod, got %+v", term)
+	}
+	machineAPIControllerLabels := labels.Set{"api": "clusterapi", "k8s-app": "controller"}
+	if affinitySelector.Matches(machineAPIControllerLabels) {
+		t.Errorf("Expected the baremetal-operator not to follow the machine-api controllers, got %v", affinitySelector)
+	}
+
+	// Each pod only rolls out for the Secrets it consumes
+	annotations := operatorDeployment.Spec.Template.Annotations
+	if _, ok := annotations[secretHashAnnotationPrefix+baremetalSecretName]; ok {
+		t.Errorf("Expected no hash of the MariaDB password in the baremetal-operator pod, got %v", annotations)
+	}
+	if _, ok := annotations[secretHashAnnotationPrefix+baremetalIronicSecretName]; !ok {
+		t.Errorf("Expected a hash of the Ironic credentials in the baremetal-operator pod, got %v", annotations)
+	}
+	for _, volume := range metal3Deployment.Spec.Template.Spec.Volumes {
+		if volume.Name == baremetalIronicSecretName {
+			t.Errorf("Expected the metal3 pod not to mount the Ironic client credentials")
+		}
+	}
+
+	// The Combined layout keeps the baremetal-operator in the metal3 pod
+	found := false
+	for _, container := range newMetal3Deployment(operatorConfig, getBaremetalProvisioningConfig(provisioningCR), secrets).Spec.Template.Spec.Containers {
+		if container.Name == "metal3-baremetal-operator" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected the baremetal-operator in the metal3 pod of the Combined layout")
+	}
+}
+
+func TestMetal3SecurityContext(t *testing.T) {
+	operatorConfig := &OperatorConfig{TargetNamespace: "test-namespace"}
+	cr := provisioningCR.DeepCopy()
+	cr.Spec.ManageHostFirewall = true
+	template := newMetal3PodTemplateSpec(operatorConfig, getBaremetalProvisioningConfig(cr), nil)
+	if template.Spec.ServiceAccountName != baremetalServiceAccountName {
+		t.Errorf("Expected the pod to run as %s, got %s", baremetalServiceAccountName, template.Spec.ServiceAccountName)
+	}
+	if template.Spec.SecurityContext != nil && template.Spec.SecurityContext.RunAsNonRoot != nil {
+		t.Errorf("Expected the pod not to set RunAsNonRoot, got %v", *template.Spec.SecurityContext.RunAsNonRoot)
+	}
+
+	// Only the containers managing the provisioning interface and the
+	// host firewall are granted capabilities
+	expectedCapabilities := map[string]bool{
+		"metal3-dnsmasq":           true,
+		"metal3-static-ip-set":     true,
+		"metal3-static-ip-manager": true,
+		"metal3-host-firewall":     true,
+	}
+	for _, container := range append(template.Spec.InitContainers, template.Spec.Containers...) {
+		securityContext := container.SecurityContext
+		if securityContext == nil || securityContext.Privileged == nil || *securityContext.Privileged {
+			t.Errorf("Expected %s not to be privileged", container.Name)
+			continue
+		}
+		if securityContext.AllowPrivilegeEscalation == nil || *securityContext.AllowPrivilegeEscalation {
+			t.Errorf("Expected %s not to allow privilege escalation", container.Name)
+		}
+		added := []corev1.Capability{}
+		if securityContext.Capabilities != nil {
+			added = securityContext.Capabilities.Add
+		}
+		if expectedCapabilities[container.Name] {
+			if !reflect.DeepEqual(added, networkAdminCapabilities) {
+				t.Errorf("Expected %s to be granted %v, got %v", container.Name, networkAdminCapabilities, added)
+			}
+		} else if len(added) > 0 {
+			t.Errorf("Expected %s to be granted no capabilities, got %v", container.Name, added)
+		}
+	}
+}
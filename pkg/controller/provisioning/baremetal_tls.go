@@ -0,0 +1,313 @@
+package provisioning
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// baremetalCASecretName holds the CA signing the serving certificate
+	// of the metal3 pod. It is not mounted into the pod.
+	baremetalCASecretName = "metal3-ca"
+	// baremetalTLSSecretName holds the serving certificate shared by
+	// ironic-api, ironic-inspector and httpd, which all listen on the
+	// provisioning IP, along with the CA certificate clients trust.
+	baremetalTLSSecretName = "metal3-ironic-tls"
+	baremetalCACertKey     = "ca.crt"
+
+	baremetalTLSVolume = "metal3-ironic-tls"
+	baremetalCAVolume  = "metal3-ironic-ca"
+
+	// Where the containers of the ironic image look for certificates
+	ironicCertDir          = "/certs/ironic"
+	ironicInspectorCertDir = "/certs/ironic-inspector"
+	ironicVmediaCertDir    = "/certs/vmedia"
+	ironicCACertDir        = "/certs/ca"
+
+	baremetalCAValidity      = 2 * 365 * 24 * time.Hour
+	baremetalServingValidity = 365 * 24 * time.Hour
+)
+
+// certificateRenewalTime returns when cert is renewed, once 80% of its
+// validity has passed, so that it never expires while in use.
+func certificateRenewalTime(cert *x509.Certificate) time.Time {
+	validity := cert.NotAfter.Sub(cert.NotBefore)
+	return cert.NotBefore.Add(validity / 5 * 4)
+}
+
+func newCertificateSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func encodeCertificate(der []byte, key *ecdsa.PrivateKey) (certPEM, keyPEM []byte, err error) {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// parseCertificate parses the certificate and key in PEM format found in
+// a Secret of type kubernetes.io/tls.
+func parseCertificate(certPEM, keyPEM []byte) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, nil, fmt.Errorf("no certificate found")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, nil, fmt.Errorf("no private key found")
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// newCACertificate generates a self-signed CA valid from now.
+func newCACertificate(now time.Time) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := newCertificateSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: fmt.Sprintf("%s@%d", baremetalCASecretName, now.Unix())},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(baremetalCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encodeCertificate(der, key)
+}
+
+// newServingCertificate generates a serving certificate for ips, signed by
+// the CA, and valid from now.
+func newServingCertificate(ca *x509.Certificate, caKey *ecdsa.PrivateKey, ips []net.IP, now time.Time) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := newCertificateSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	notAfter := now.Add(baremetalServingValidity)
+	if notAfter.After(ca.NotAfter) {
+		notAfter = ca.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: baremetalDeploymentName},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encodeCertificate(der, key)
+}
+
+// getServingIPs returns the addresses the metal3 pod serves on, sorted so
+// that they can be compared with those of an existing certificate.
+func getServingIPs(baremetalConfig BaremetalProvisioningConfig) []net.IP {
+	ips := []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}
+	for _, ip := range []string{baremetalConfig.ProvisioningIp, baremetalConfig.ProvisioningSecondaryIp} {
+		if parsed := net.ParseIP(ip); parsed != nil {
+			ips = append(ips, parsed)
+		}
+	}
+	sortIPs(ips)
+	return ips
+}
+
+func sortIPs(ips []net.IP) {
+	for i := range ips {
+		ips[i] = ips[i].To16()
+	}
+	sort.Slice(ips, func(i, j int) bool { return bytes.Compare(ips[i], ips[j]) < 0 })
+}
+
+// caNeedsRenewal reports whether the CA in secret is missing, invalid or
+// due for renewal at now.
+func caNeedsRenewal(secret *corev1.Secret, now time.Time) bool {
+	ca, _, err := parseCertificate(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	return err != nil || !ca.IsCA || !now.Before(certificateRenewalTime(ca))
+}
+
+// servingNeedsRenewal reports whether the serving certificate in secret is
+// missing, invalid, not signed by ca, not valid for ips or due for renewal
+// at now.
+func servingNeedsRenewal(secret *corev1.Secret, caPEM []byte, ca *x509.Certificate, ips []net.IP, now time.Time) bool {
+	cert, _, err := parseCertificate(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil || !bytes.Equal(secret.Data[baremetalCACertKey], caPEM) || cert.CheckSignatureFrom(ca) != nil {
+		return true
+	}
+	certIPs := append([]net.IP{}, cert.IPAddresses...)
+	sortIPs(certIPs)
+	if !reflect.DeepEqual(certIPs, ips) {
+		return true
+	}
+	return !now.Before(certificateRenewalTime(cert))
+}
+
+// ensureTLSSecrets generates the CA and the serving certificate of the
+// metal3 pod, and renews them when they are due. It returns the Secret
+// holding the serving certificate and the time until a certificate is
+// next renewed.
+func (r *ReconcileProvisioning) ensureTLSSecrets(baremetalConfig BaremetalProvisioningConfig, ownerReferences []metav1.OwnerReference) (*corev1.Secret, time.Duration, error) {
+	now := time.Now()
+
+	caSecret, err := r.getOrNewTLSSecret(baremetalCASecretName)
+	if err != nil {
+		return nil, 0, err
+	}
+	if caNeedsRenewal(caSecret, now) {
+		log.Info("Generating a new CA", "Secret.Namespace", caSecret.Namespace, "Secret.Name", caSecret.Name)
+		certPEM, keyPEM, err := newCACertificate(now)
+		if err != nil {
+			return nil, 0, err
+		}
+		caSecret.Data = map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM}
+		if err := r.saveTLSSecret(caSecret, ownerReferences); err != nil {
+			return nil, 0, err
+		}
+	}
+	caPEM := caSecret.Data[corev1.TLSCertKey]
+	ca, caKey, err := parseCertificate(caPEM, caSecret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	servingSecret, err := r.getOrNewTLSSecret(baremetalTLSSecretName)
+	if err != nil {
+		return nil, 0, err
+	}
+	ips := getServingIPs(baremetalConfig)
+	if servingNeedsRenewal(servingSecret, caPEM, ca, ips, now) {
+		log.Info("Generating a new serving certificate", "Secret.Namespace", servingSecret.Namespace, "Secret.Name", servingSecret.Name)
+		certPEM, keyPEM, err := newServingCertificate(ca, caKey, ips, now)
+		if err != nil {
+			return nil, 0, err
+		}
+		servingSecret.Data = map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM, baremetalCACertKey: caPEM}
+		if err := r.saveTLSSecret(servingSecret, ownerReferences); err != nil {
+			return nil, 0, err
+		}
+	}
+	cert, _, err := parseCertificate(servingSecret.Data[corev1.TLSCertKey], servingSecret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The serving certificate is renewed along with the CA, so it is
+	// always the first one due
+	return servingSecret, certificateRenewalTime(cert).Sub(now), nil
+}
+
+// getOrNewTLSSecret returns the Secret called name, or a new empty one
+// when it does not exist yet.
+func (r *ReconcileProvisioning) getOrNewTLSSecret(name string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: r.config.TargetNamespace}, secret)
+	if errors.IsNotFound(err) {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: r.config.TargetNamespace,
+			},
+			Type: corev1.SecretTypeTLS,
+		}, nil
+	}
+	return secret, err
+}
+
+func (r *ReconcileProvisioning) saveTLSSecret(secret *corev1.Secret, ownerReferences []metav1.OwnerReference) error {
+	secret.OwnerReferences = ownerReferences
+	if secret.ResourceVersion == "" {
+		return r.client.Create(context.TODO(), secret)
+	}
+	return r.client.Update(context.TODO(), secret)
+}
+
+// newServingCertVolume returns the volume holding the serving certificate.
+func newServingCertVolume() corev1.Volume {
+	return corev1.Volume{
+		Name: baremetalTLSVolume,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: baremetalTLSSecretName,
+			},
+		},
+	}
+}
+
+// newCACertVolume returns the volume holding the CA certificate alone, for
+// containers that are only clients.
+func newCACertVolume() corev1.Volume {
+	return corev1.Volume{
+		Name: baremetalCAVolume,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: baremetalTLSSecretName,
+				Items: []corev1.KeyToPath{
+					{Key: baremetalCACertKey, Path: baremetalCACertKey},
+				},
+			},
+		},
+	}
+}
+
+func newServingCertVolumeMount(dir string) corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      baremetalTLSVolume,
+		MountPath: dir,
+		ReadOnly:  true,
+	}
+}
+
+func newCACertVolumeMount() corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      baremetalCAVolume,
+		MountPath: ironicCACertDir,
+		ReadOnly:  true,
+	}
+}
@@ -0,0 +1,120 @@
+package provisioning
+
+import (
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func newTestTLSSecrets(t *testing.T, baremetalConfig BaremetalProvisioningConfig, now time.Time) (*corev1.Secret, *corev1.Secret) {
+	caPEM, caKeyPEM, err := newCACertificate(now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ca, caKey, err := parseCertificate(caPEM, caKeyPEM)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	certPEM, keyPEM, err := newServingCertificate(ca, caKey, getServingIPs(baremetalConfig), now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	caSecret := &corev1.Secret{
+		Data: map[string][]byte{corev1.TLSCertKey: caPEM, corev1.TLSPrivateKeyKey: caKeyPEM},
+	}
+	servingSecret := &corev1.Secret{
+		Data: map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM, baremetalCACertKey: caPEM},
+	}
+	return caSecret, servingSecret
+}
+
+func TestServingCertificate(t *testing.T) {
+	baremetalConfig := getBaremetalProvisioningConfig(provisioningCR)
+	now := time.Now()
+	_, servingSecret := newTestTLSSecrets(t, baremetalConfig, now)
+
+	cert, _, err := parseCertificate(servingSecret.Data[corev1.TLSCertKey], servingSecret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(servingSecret.Data[baremetalCACertKey]) {
+		t.Fatal("Failure reading the CA certificate")
+	}
+	for _, name := range []string{expectedProvisioningIP, "127.0.0.1", "::1", "localhost"} {
+		_, err := cert.Verify(x509.VerifyOptions{DNSName: name, Roots: roots, CurrentTime: now})
+		if err != nil {
+			t.Errorf("Expected the certificate to be valid for %s: %v", name, err)
+		}
+	}
+}
+
+func TestTLSRenewal(t *testing.T) {
+	baremetalConfig := getBaremetalProvisioningConfig(provisioningCR)
+	now := time.Now()
+	caSecret, servingSecret := newTestTLSSecrets(t, baremetalConfig, now)
+	caPEM := caSecret.Data[corev1.TLSCertKey]
+	ca, _, err := parseCertificate(caPEM, caSecret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ips := getServingIPs(baremetalConfig)
+
+	if caNeedsRenewal(caSecret, now) || servingNeedsRenewal(servingSecret, caPEM, ca, ips, now) {
+		t.Errorf("Expected new certificates not to need renewal")
+	}
+	if !caNeedsRenewal(&corev1.Secret{}, now) || !servingNeedsRenewal(&corev1.Secret{}, caPEM, ca, ips, now) {
+		t.Errorf("Expected missing certificates to need renewal")
+	}
+
+	// Certificates are renewed once 80% of their validity has passed
+	later := now.Add(baremetalServingValidity * 9 / 10)
+	if caNeedsRenewal(caSecret, later) {
+		t.Errorf("Expected the CA not to need renewal at %s", later)
+	}
+	if !servingNeedsRenewal(servingSecret, caPEM, ca, ips, later) {
+		t.Errorf("Expected the serving certificate to need renewal at %s", later)
+	}
+	if !caNeedsRenewal(caSecret, now.Add(baremetalCAValidity*9/10)) {
+		t.Errorf("Expected the CA to need renewal")
+	}
+
+	// A new provisioning IP needs a new serving certificate
+	baremetalConfig.ProvisioningIp = "172.30.20.4"
+	if !servingNeedsRenewal(servingSecret, caPEM, ca, getServingIPs(baremetalConfig), now) {
+		t.Errorf("Expected a serving certificate for a new IP to need renewal")
+	}
+
+	// So does a new CA
+	otherCASecret, _ := newTestTLSSecrets(t, baremetalConfig, now)
+	otherCAPEM := otherCASecret.Data[corev1.TLSCertKey]
+	otherCA, _, err := parseCertificate(otherCAPEM, otherCASecret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !servingNeedsRenewal(servingSecret, otherCAPEM, otherCA, ips, now) {
+		t.Errorf("Expected a serving certificate of another CA to need renewal")
+	}
+}
+
+func TestGetServingIPs(t *testing.T) {
+	baremetalConfig := BaremetalProvisioningConfig{
+		ProvisioningIp:          "fd00:1101::3",
+		ProvisioningSecondaryIp: "172.30.20.3",
+	}
+	ips := getServingIPs(baremetalConfig)
+	for _, expected := range []string{"127.0.0.1", "::1", "fd00:1101::3", "172.30.20.3"} {
+		found := false
+		for _, ip := range ips {
+			if ip.Equal(net.ParseIP(expected)) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected %s among the serving IPs, got %v", expected, ips)
+		}
+	}
+}
@@ -2,186 +2,479 @@ package provisioning
 
 import (
 	"context"
-	"os"
-	"time"
+	"fmt"
+	"strings"
 
-	"github.com/golang/glog"
 	configv1 "github.com/openshift/api/config/v1"
-	osoperatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	metal3v1alpha1 "github.com/openshift/cluster-baremetal-operator/pkg/apis/metal3/v1alpha1"
+	"github.com/openshift/library-go/pkg/config/clusteroperator/v1helpers"
 	operatorv1helpers "github.com/openshift/library-go/pkg/operator/v1helpers"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"k8s.io/client-go/kubernetes"
-	osclientset "github.com/openshift/client-go/config/clientset/versioned"
-	"k8s.io/client-go/tools/record"
-	appslisterv1 "k8s.io/client-go/listers/apps/v1"
-	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/util/workqueue"
-	appsinformersv1 "k8s.io/client-go/informers/apps/v1"	
 )
 
-// CBO defines the cluster baremetal operator.
-type CBO struct {
-        namespace, name string
+// clusterOperatorName is the name of the ClusterOperator reporting the
+// status of the operator to the cluster version operator.
+const clusterOperatorName = "baremetal"
 
-        imagesFile string
-        config     string
+// statusReporter owns the baremetal ClusterOperator and reports the
+// status of the operator through it.
+type statusReporter struct {
+	client          client.Client
+	targetNamespace string
+	version         string
+}
 
-        kubeClient    kubernetes.Interface
-        osClient      osclientset.Interface
-        eventRecorder record.EventRecorder
+func newStatusReporter(c client.Client, targetNamespace string, version string) *statusReporter {
+	return &statusReporter{
+		client:          c,
+		targetNamespace: targetNamespace,
+		version:         version,
+	}
+}
 
-        syncHandler func(ic string) error
+// getOrCreateClusterOperator fetches the ClusterOperator, creating it
+// without any status if it does not exist yet.
+func (s *statusReporter) getOrCreateClusterOperator() (*configv1.ClusterOperator, error) {
+	co := &configv1.ClusterOperator{}
+	err := s.client.Get(context.TODO(), types.NamespacedName{Name: clusterOperatorName}, co)
+	if err == nil {
+		return co, nil
+	}
+	if !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get ClusterOperator %q: %v", clusterOperatorName, err)
+	}
 
-        deployLister       appslisterv1.DeploymentLister
-        deployListerSynced cache.InformerSynced
+	co = &configv1.ClusterOperator{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ClusterOperator",
+			APIVersion: "config.openshift.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: clusterOperatorName,
+		},
+	}
+	err = s.client.Create(context.TODO(), co)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ClusterOperator %q: %v", clusterOperatorName, err)
+	}
+	return co, nil
+}
 
-        // queue only ever has one item, but it has nice error handling backoff/retry semantics
-        queue           workqueue.RateLimitingInterface
-        operandVersions []configv1.OperandVersion
+// sync sets conditions and the versions of operands on the ClusterOperator,
+// along with its related objects and the version of the operator. Operands
+// missing from operandVersions keep the version reported previously. The
+// status is written through the status subresource, and only when it
+// changed.
+func (s *statusReporter) sync(conditions []configv1.ClusterOperatorStatusCondition, operandVersions []configv1.OperandVersion) error {
+	co, err := s.getOrCreateClusterOperator()
+	if err != nil {
+		return err
+	}
 
-        generations []osoperatorv1.GenerationStatus
-}
+	prevStatus := co.Status.DeepCopy()
+	co.Status.RelatedObjects = relatedObjects(s.targetNamespace)
+	for _, condition := range conditions {
+		v1helpers.SetStatusCondition(&co.Status.Conditions, condition)
+	}
 
-// New returns a new cluster baremetal operator.
-func New(
-        namespace, name string,
-        imagesFile string,
+	operatorv1helpers.SetOperandVersion(&co.Status.Versions, configv1.OperandVersion{Name: "operator", Version: s.version})
+	for _, operandVersion := range operandVersions {
+		operatorv1helpers.SetOperandVersion(&co.Status.Versions, operandVersion)
+	}
 
-        config string,
+	if equality.Semantic.DeepEqual(&co.Status, prevStatus) {
+		return nil
+	}
 
-        deployInformer appsinformersv1.DeploymentInformer,
+	return s.client.Status().Update(context.TODO(), co)
+}
 
-        kubeClient kubernetes.Interface,
-        osClient osclientset.Interface,
+// relatedObjects lists the objects collected by must-gather for the
+// operator. Every kind of object the operator manages belongs here, even
+// when it is only created for some configurations.
+func relatedObjects(targetNamespace string) []configv1.ObjectReference {
+	return []configv1.ObjectReference{
+		{
+			Group:    "",
+			Resource: "namespaces",
+			Name:     targetNamespace,
+		},
+		{
+			Group:    metal3v1alpha1.SchemeGroupVersion.Group,
+			Resource: "provisionings",
+			Name:     baremetalProvisioningCR,
+		},
+		{
+			Group:     metal3v1alpha1.SchemeGroupVersion.Group,
+			Resource:  "baremetalhosts",
+			Namespace: targetNamespace,
+		},
+		{
+			Group:    "apiextensions.k8s.io",
+			Resource: "customresourcedefinitions",
+			Name:     "provisionings.metal3.io",
+		},
+		{
+			Group:    "apiextensions.k8s.io",
+			Resource: "customresourcedefinitions",
+			Name:     "baremetalhosts.metal3.io",
+		},
+		{
+			Group:     "apps",
+			Resource:  "deployments",
+			Namespace: targetNamespace,
+			Name:      baremetalDeploymentName,
+		},
+		{
+			Group:     "apps",
+			Resource:  "deployments",
+			Namespace: targetNamespace,
+			Name:      baremetalOperatorDeploymentName,
+		},
+		{
+			Group:     "",
+			Resource:  "configmaps",
+			Namespace: targetNamespace,
+			Name:      baremetalConfigmap,
+		},
+		{
+			Group:     "",
+			Resource:  "configmaps",
+			Namespace: targetNamespace,
+			Name:      baremetalTrustedCAConfigMap,
+		},
+		{
+			Group:     "",
+			Resource:  "secrets",
+			Namespace: targetNamespace,
+			Name:      baremetalSecretName,
+		},
+		{
+			Group:     "",
+			Resource:  "secrets",
+			Namespace: targetNamespace,
+			Name:      baremetalIronicSecretName,
+		},
+		{
+			Group:     "",
+			Resource:  "secrets",
+			Namespace: targetNamespace,
+			Name:      baremetalIronicInspectorSecretName,
+		},
+		{
+			Group:     "",
+			Resource:  "secrets",
+			Namespace: targetNamespace,
+			Name:      baremetalCASecretName,
+		},
+		{
+			Group:     "",
+			Resource:  "secrets",
+			Namespace: targetNamespace,
+			Name:      baremetalTLSSecretName,
+		},
+		{
+			Group:     "",
+			Resource:  "services",
+			Namespace: targetNamespace,
+			Name:      baremetalImageEndpoint,
+		},
+		{
+			Group:     "",
+			Resource:  "persistentvolumeclaims",
+			Namespace: targetNamespace,
+			Name:      baremetalImageCacheClaimName,
+		},
+		{
+			Group:     "",
+			Resource:  "persistentvolumeclaims",
+			Namespace: targetNamespace,
+			Name:      baremetalDatabaseClaimName,
+		},
+		{
+			Group:     routev1.GroupName,
+			Resource:  "routes",
+			Namespace: targetNamespace,
+			Name:      baremetalImageEndpoint,
+		},
+		{
+			Group:    "security.openshift.io",
+			Resource: "securitycontextconstraints",
+			Name:     baremetalSecurityContextConstraints,
+		},
+	}
+}
 
-        recorder record.EventRecorder,
-) *CBO {
-	operandVersions := []configv1.OperandVersion{}
-        if releaseVersion := os.Getenv("RELEASE_VERSION"); len(releaseVersion) > 0 {
-                operandVersions = append(operandVersions, configv1.OperandVersion{Name: "operator", Version: releaseVersion})
-        }
+// OperatorDisabled reports when the primary function of the operator has been disabled.
+const OperatorDisabled configv1.ClusterStatusConditionType = "Disabled"
 
-	cbo := &CBO{
-                namespace:       namespace,
-                name:            name,
-                imagesFile:      imagesFile,
-                kubeClient:      kubeClient,
-                osClient:        osClient,
-                eventRecorder:   recorder,
-                queue:           workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "clusterbaremetaloperator"),
-                operandVersions: operandVersions,
-        }
+// Reasons of the ClusterOperator conditions
+const (
+	reasonUnsupportedPlatform        = "UnsupportedPlatform"
+	reasonInvalidConfiguration       = "InvalidConfiguration"
+	reasonDeploymentAvailable        = "DeploymentAvailable"
+	reasonDeploymentUnavailable      = "DeploymentUnavailable"
+	reasonDeploymentRollingOut       = "DeploymentRollingOut"
+	reasonDeploymentDeadlineExceeded = "DeploymentProgressDeadlineExceeded"
+	reasonUnmanaged                  = "Unmanaged"
+	reasonRemoved                    = "Removed"
+	reasonProvisioningDeleted        = "ProvisioningDeleted"
+	reasonProvisioningNotFound       = "ProvisioningNotFound"
+)
 
-	// TODO : Figure out if and how we want to manage the event handler queue
-	//deployInformer.Informer().AddEventHandler(cbo.eventHandlerDeployments())
+func newClusterOperatorCondition(conditionType configv1.ClusterStatusConditionType, status configv1.ConditionStatus, reason, message string) configv1.ClusterOperatorStatusCondition {
+	return configv1.ClusterOperatorStatusCondition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}
+}
 
-	cbo.config = config
-	cbo.syncHandler = sync
+// disabledConditions reports the operator as available but disabled when
+// there is nothing to deploy, such as on platforms other than bare metal.
+func disabledConditions(reason, message string) []configv1.ClusterOperatorStatusCondition {
+	return []configv1.ClusterOperatorStatusCondition{
+		newClusterOperatorCondition(configv1.OperatorAvailable, configv1.ConditionTrue, reason, message),
+		newClusterOperatorCondition(configv1.OperatorProgressing, configv1.ConditionFalse, reason, message),
+		newClusterOperatorCondition(configv1.OperatorDegraded, configv1.ConditionFalse, reason, message),
+		newClusterOperatorCondition(configv1.OperatorUpgradeable, configv1.ConditionTrue, reason, message),
+		newClusterOperatorCondition(OperatorDisabled, configv1.ConditionTrue, reason, message),
+	}
+}
 
-        cbo.deployLister = deployInformer.Lister()
-        cbo.deployListerSynced = deployInformer.Informer().HasSynced
+// unmanagedConditions reports that the operator leaves the metal3
+// components as they are. Availability is left unchanged, as it is no
+// longer tracked, and upgrades are held back since they would not reach
+// the components.
+func unmanagedConditions() []configv1.ClusterOperatorStatusCondition {
+	message := "The metal3 components are not managed, as the Provisioning managementState is Unmanaged"
+	return []configv1.ClusterOperatorStatusCondition{
+		newClusterOperatorCondition(configv1.OperatorProgressing, configv1.ConditionFalse, reasonUnmanaged, message),
+		newClusterOperatorCondition(configv1.OperatorDegraded, configv1.ConditionFalse, reasonUnmanaged, message),
+		newClusterOperatorCondition(configv1.OperatorUpgradeable, configv1.ConditionFalse, reasonUnmanaged, message),
+		newClusterOperatorCondition(OperatorDisabled, configv1.ConditionFalse, reasonUnmanaged, message),
+	}
+}
 
-        return cbo
+// removalConditions reports the operator as progressing while the objects
+// listed in remaining are being deleted, and as disabled with message once
+// they are all gone.
+func removalConditions(reason, message string, remaining []string) []configv1.ClusterOperatorStatusCondition {
+	if len(remaining) == 0 {
+		return disabledConditions(reason, message)
+	}
+	message = fmt.Sprintf("Removing the metal3 components: waiting for %s to be deleted", strings.Join(remaining, ", "))
+	return []configv1.ClusterOperatorStatusCondition{
+		newClusterOperatorCondition(configv1.OperatorAvailable, configv1.ConditionTrue, reason, message),
+		newClusterOperatorCondition(configv1.OperatorProgressing, configv1.ConditionTrue, reason, message),
+		newClusterOperatorCondition(configv1.OperatorDegraded, configv1.ConditionFalse, reason, message),
+		newClusterOperatorCondition(configv1.OperatorUpgradeable, configv1.ConditionTrue, reason, message),
+		newClusterOperatorCondition(OperatorDisabled, configv1.ConditionFalse, reason, message),
+	}
 }
 
-func sync(key string) error {
-        startTime := time.Now()
-        glog.V(4).Infof("Started syncing Cluster Baremetal Operator %q (%v)", key, startTime)
-        defer func() {
-                glog.V(4).Infof("Finished syncing Cluster Baremetal Operator %q (%v)", key, time.Since(startTime))
-        }()
+// invalidConfigurationConditions reports the operator as degraded when the
+// Provisioning configuration cannot be rendered. Availability is left
+// unchanged, as the previously rendered deployment keeps running.
+func invalidConfigurationConditions(err error) []configv1.ClusterOperatorStatusCondition {
+	message := fmt.Sprintf("Invalid Provisioning configuration: %v", err)
+	return []configv1.ClusterOperatorStatusCondition{
+		newClusterOperatorCondition(configv1.OperatorProgressing, configv1.ConditionFalse, reasonInvalidConfiguration, message),
+		newClusterOperatorCondition(configv1.OperatorDegraded, configv1.ConditionTrue, reasonInvalidConfiguration, message),
+		newClusterOperatorCondition(configv1.OperatorUpgradeable, configv1.ConditionFalse, reasonInvalidConfiguration, message),
+		newClusterOperatorCondition(OperatorDisabled, configv1.ConditionFalse, reasonInvalidConfiguration, message),
+	}
+}
 
-        //return syncClusterOperator(r.client, r.config.TargetNamespace, os.Getenv("OPERATOR_VERSION"), true, false)
-	return nil
+// workloadConditions merges the ClusterOperator conditions derived from
+// the status of each of the deployments. The operator is Available and
+// Upgradeable only when every deployment is, and Progressing or Degraded
+// as soon as one is.
+func workloadConditions(deployments []*appsv1.Deployment) []configv1.ClusterOperatorStatusCondition {
+	conditions := []configv1.ClusterOperatorStatusCondition{}
+	for _, deployment := range deployments {
+		for _, condition := range deploymentConditions(deployment) {
+			conditions = mergeCondition(conditions, condition)
+		}
+	}
+	return conditions
 }
 
-func syncClusterOperator(c client.Client, targetNamespace string, version string, done, disabled bool) error {
-	name := types.NamespacedName{Name: "baremetal"}
+// isAbnormalCondition reports whether condition calls for attention.
+func isAbnormalCondition(condition configv1.ClusterOperatorStatusCondition) bool {
+	switch condition.Type {
+	case configv1.OperatorAvailable, configv1.OperatorUpgradeable:
+		return condition.Status != configv1.ConditionTrue
+	}
+	return condition.Status == configv1.ConditionTrue
+}
 
-	co := &configv1.ClusterOperator{}
-	err := c.Get(context.Background(), name, co)
-	if err != nil {
-		// Not found - create the resource
-		if errors.IsNotFound(err) {
-			co = &configv1.ClusterOperator{
-				TypeMeta: metav1.TypeMeta{
-					Kind:       "ClusterOperator",
-					APIVersion: "config.openshift.io/v1",
-				},
-				ObjectMeta: metav1.ObjectMeta{
-					Name: name.Name,
-				},
-				Status: configv1.ClusterOperatorStatus{
-					RelatedObjects: []configv1.ObjectReference{
-						{
-							Group:    "",
-							Resource: "namespaces",
-							Name:     targetNamespace,
-						},
-					},
-				},
-			}
-			err = c.Create(context.TODO(), co)
-			if err != nil {
-				return err
+// mergeCondition adds condition to conditions. An abnormal condition
+// replaces a normal one of the same type, and the messages of conditions
+// of the same status are joined.
+func mergeCondition(conditions []configv1.ClusterOperatorStatusCondition, condition configv1.ClusterOperatorStatusCondition) []configv1.ClusterOperatorStatusCondition {
+	for i := range conditions {
+		existing := &conditions[i]
+		if existing.Type != condition.Type {
+			continue
+		}
+		if existing.Status == condition.Status {
+			if existing.Message == "" {
+				existing.Message = condition.Message
+			} else if condition.Message != "" {
+				existing.Message += "; " + condition.Message
 			}
-		} else {
-			return err
+		} else if isAbnormalCondition(condition) {
+			*existing = condition
 		}
+		return conditions
 	}
+	return append(conditions, condition)
+}
 
-	prevConditions := co.Status.Conditions
-	co.Status.Conditions = updateConditions(prevConditions, done, disabled)
+// deploymentConditions derives the ClusterOperator conditions from the
+// status of one of the metal3 deployments.
+func deploymentConditions(deployment *appsv1.Deployment) []configv1.ClusterOperatorStatusCondition {
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
 
-	operatorv1helpers.SetOperandVersion(&co.Status.Versions, configv1.OperandVersion{Name: "operator", Version: version})
+	conditions := []configv1.ClusterOperatorStatusCondition{
+		newClusterOperatorCondition(OperatorDisabled, configv1.ConditionFalse, reasonAsExpected, ""),
+	}
 
-	if conditionsEquals(co.Status.Conditions, prevConditions) {
-		return nil
+	replicasMessage := fmt.Sprintf("Deployment %s has %d/%d ready replicas", deployment.Name, status.ReadyReplicas, desired)
+	if status.ReadyReplicas > 0 {
+		conditions = append(conditions, newClusterOperatorCondition(configv1.OperatorAvailable, configv1.ConditionTrue, reasonDeploymentAvailable, replicasMessage))
+	} else {
+		conditions = append(conditions, newClusterOperatorCondition(configv1.OperatorAvailable, configv1.ConditionFalse, reasonDeploymentUnavailable, replicasMessage))
 	}
 
-	err = c.Update(context.TODO(), co)
-	if err != nil {
-		return err
+	// The deployment controller gives up on a rollout that makes no
+	// progress within the deadline, which needs an administrator to
+	// look into it
+	for _, condition := range status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Status == corev1.ConditionFalse && condition.Reason == "ProgressDeadlineExceeded" {
+			message := fmt.Sprintf("Deployment %s: %s", deployment.Name, condition.Message)
+			return append(conditions,
+				newClusterOperatorCondition(configv1.OperatorProgressing, configv1.ConditionFalse, reasonDeploymentDeadlineExceeded, message),
+				newClusterOperatorCondition(configv1.OperatorDegraded, configv1.ConditionTrue, reasonDeploymentDeadlineExceeded, message),
+				newClusterOperatorCondition(configv1.OperatorUpgradeable, configv1.ConditionFalse, reasonDeploymentDeadlineExceeded, message),
+			)
+		}
 	}
 
-	return nil
+	conditions = append(conditions,
+		newClusterOperatorCondition(configv1.OperatorDegraded, configv1.ConditionFalse, reasonAsExpected, ""),
+		newClusterOperatorCondition(configv1.OperatorUpgradeable, configv1.ConditionTrue, reasonAsExpected, ""),
+	)
+	if status.ObservedGeneration < deployment.Generation {
+		message := fmt.Sprintf("Waiting for the deployment controller to observe generation %d of deployment %s", deployment.Generation, deployment.Name)
+		return append(conditions, newClusterOperatorCondition(configv1.OperatorProgressing, configv1.ConditionTrue, reasonDeploymentRollingOut, message))
+	}
+	if !isDeploymentRolledOut(deployment) {
+		message := fmt.Sprintf("Deployment %s is rolling out: %d/%d replicas updated, %d/%d available",
+			deployment.Name, status.UpdatedReplicas, desired, status.AvailableReplicas, desired)
+		return append(conditions, newClusterOperatorCondition(configv1.OperatorProgressing, configv1.ConditionTrue, reasonDeploymentRollingOut, message))
+	}
+	return append(conditions, newClusterOperatorCondition(configv1.OperatorProgressing, configv1.ConditionFalse, reasonAsExpected,
+		fmt.Sprintf("Deployment %s is rolled out", deployment.Name)))
 }
 
-// OperatorDisabled reports when the primary function of the operator has been disabled.
-const OperatorDisabled configv1.ClusterStatusConditionType = "Disabled"
+// isDeploymentRolledOut reports whether every replica of the deployment
+// runs its current pod template and is available.
+func isDeploymentRolledOut(deployment *appsv1.Deployment) bool {
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	return status.ObservedGeneration >= deployment.Generation &&
+		status.UpdatedReplicas == desired &&
+		status.Replicas == desired &&
+		status.AvailableReplicas == desired
+}
 
-func updateConditions(conditions []configv1.ClusterOperatorStatusCondition, done, disabled bool) []configv1.ClusterOperatorStatusCondition {
-	// FIXME: actually implement the expected semantics of these conditions
-	conditions = []configv1.ClusterOperatorStatusCondition{
-		{
-			Type:   configv1.OperatorAvailable,
-			Status: configv1.ConditionFalse,
-		}, {
-			Type:   configv1.OperatorProgressing,
-			Status: configv1.ConditionFalse,
-		}, {
-			Type:   configv1.OperatorDegraded,
-			Status: configv1.ConditionFalse,
-		}, {
-			Type:   OperatorDisabled,
-			Status: configv1.ConditionFalse,
-		},
-	}
-	if done {
-		conditions[0].Status = configv1.ConditionTrue
-	} else {
-		conditions[1].Status = configv1.ConditionTrue
+// workloadOperandVersions returns the versions of the operands run by each
+// of the deployments that has fully rolled out.
+func workloadOperandVersions(config *OperatorConfig, deployments []*appsv1.Deployment, version string) []configv1.OperandVersion {
+	operandVersions := []configv1.OperandVersion{}
+	for _, deployment := range deployments {
+		operandVersions = append(operandVersions, deploymentOperandVersions(config, deployment, version)...)
 	}
-	if disabled {
-		conditions[3].Status = configv1.ConditionTrue
+	return operandVersions
+}
+
+// operand is a component whose version is reported on the ClusterOperator,
+// along with the image it runs from.
+type operand struct {
+	name  string
+	image string
+}
+
+// metal3Operands lists the operands reported on the ClusterOperator. They
+// must match the versions declared in the ClusterOperator manifest, as
+// the CVO waits for each of them to reach the release version.
+func metal3Operands(config *OperatorConfig) []operand {
+	return []operand{
+		{"baremetal-operator", config.BaremetalControllers.BaremetalOperator},
+		{"ironic", config.BaremetalControllers.Ironic},
+		{"ironic-inspector", config.BaremetalControllers.IronicInspector},
+		{"ironic-ipa-downloader", config.BaremetalControllers.IronicIpaDownloader},
+		{"ironic-machine-os-downloader", config.BaremetalControllers.IronicMachineOsDownloader},
 	}
-	return conditions
 }
 
-func conditionsEquals(conditions []configv1.ClusterOperatorStatusCondition, prev []configv1.ClusterOperatorStatusCondition) bool {
-	// FIXME: only update when something has changed
-	return false
+// allOperandVersions returns every operand at version. It is reported
+// when the operator does not run the metal3 components, as there is then
+// no rollout to wait for.
+func allOperandVersions(config *OperatorConfig, version string) []configv1.OperandVersion {
+	operandVersions := []configv1.OperandVersion{}
+	for _, operand := range metal3Operands(config) {
+		operandVersions = append(operandVersions, configv1.OperandVersion{Name: operand.name, Version: version})
+	}
+	return operandVersions
+}
+
+// removalOperandVersions returns every operand at version once none of
+// the objects of the metal3 components remain. Until then the Deployments
+// being deleted may still run the previous images, so none are returned.
+func removalOperandVersions(config *OperatorConfig, remaining []string, version string) []configv1.OperandVersion {
+	if len(remaining) > 0 {
+		return nil
+	}
+	return allOperandVersions(config, version)
+}
+
+// deploymentOperandVersions returns the versions of the operands whose
+// images the deployment runs, once it has fully rolled out. Until then the
+// previously reported versions remain accurate, so none are returned.
+func deploymentOperandVersions(config *OperatorConfig, deployment *appsv1.Deployment, version string) []configv1.OperandVersion {
+	if !isDeploymentRolledOut(deployment) {
+		return nil
+	}
+
+	images := map[string]bool{}
+	podSpec := deployment.Spec.Template.Spec
+	for _, container := range append(podSpec.InitContainers, podSpec.Containers...) {
+		images[container.Image] = true
+	}
+
+	operandVersions := []configv1.OperandVersion{}
+	for _, operand := range metal3Operands(config) {
+		if images[operand.image] {
+			operandVersions = append(operandVersions, configv1.OperandVersion{Name: operand.name, Version: version})
+		}
+	}
+	return operandVersions
 }
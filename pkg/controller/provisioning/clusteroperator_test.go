@@ -0,0 +1,512 @@
+package provisioning
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	metal3v1alpha1 "github.com/openshift/cluster-baremetal-operator/pkg/apis/metal3/v1alpha1"
+	"github.com/openshift/library-go/pkg/config/clusteroperator/v1helpers"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// fakeClusterOperatorClient stores ClusterOperators in memory. Like the
+// API server, it ignores the status on Create and Update, which is only
+// written through the status subresource. Other client methods are not
+// implemented.
+type fakeClusterOperatorClient struct {
+	client.Client
+	clusterOperators map[string]*configv1.ClusterOperator
+	statusUpdates    int
+}
+
+func newFakeClusterOperatorClient() *fakeClusterOperatorClient {
+	return &fakeClusterOperatorClient{clusterOperators: map[string]*configv1.ClusterOperator{}}
+}
+
+func (f *fakeClusterOperatorClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	existing, ok := f.clusterOperators[key.Name]
+	if !ok {
+		return apierrors.NewNotFound(configv1.Resource("clusteroperators"), key.Name)
+	}
+	existing.DeepCopyInto(obj.(*configv1.ClusterOperator))
+	return nil
+}
+
+func (f *fakeClusterOperatorClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	co := obj.(*configv1.ClusterOperator)
+	if _, ok := f.clusterOperators[co.Name]; ok {
+		return apierrors.NewAlreadyExists(configv1.Resource("clusteroperators"), co.Name)
+	}
+	stored := co.DeepCopy()
+	stored.Status = configv1.ClusterOperatorStatus{}
+	f.clusterOperators[co.Name] = stored
+	stored.DeepCopyInto(co)
+	return nil
+}
+
+func (f *fakeClusterOperatorClient) Status() client.StatusWriter {
+	return &fakeClusterOperatorStatusWriter{f}
+}
+
+type fakeClusterOperatorStatusWriter struct {
+	*fakeClusterOperatorClient
+}
+
+func (f *fakeClusterOperatorStatusWriter) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	co := obj.(*configv1.ClusterOperator)
+	existing, ok := f.clusterOperators[co.Name]
+	if !ok {
+		return apierrors.NewNotFound(configv1.Resource("clusteroperators"), co.Name)
+	}
+	co.Status.DeepCopyInto(&existing.Status)
+	f.statusUpdates++
+	return nil
+}
+
+func (f *fakeClusterOperatorStatusWriter) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return fmt.Errorf("not implemented")
+}
+
+func TestDeploymentConditions(t *testing.T) {
+	replicas := int32(1)
+	tCases := []struct {
+		name                string
+		generation          int64
+		status              appsv1.DeploymentStatus
+		expectedAvailable   configv1.ConditionStatus
+		expectedProgressing configv1.ConditionStatus
+		expectedDegraded    configv1.ConditionStatus
+		expectedReason      string
+	}{
+		{
+			name:       "RolledOut",
+			generation: 2,
+			status: appsv1.DeploymentStatus{
+				ObservedGeneration: 2,
+				Replicas:           1,
+				UpdatedReplicas:    1,
+				ReadyReplicas:      1,
+				AvailableReplicas:  1,
+			},
+			expectedAvailable:   configv1.ConditionTrue,
+			expectedProgressing: configv1.ConditionFalse,
+			expectedDegraded:    configv1.ConditionFalse,
+			expectedReason:      reasonAsExpected,
+		},
+		{
+			name:                "Created",
+			generation:          1,
+			expectedAvailable:   configv1.ConditionFalse,
+			expectedProgressing: configv1.ConditionTrue,
+			expectedDegraded:    configv1.ConditionFalse,
+			expectedReason:      reasonDeploymentRollingOut,
+		},
+		{
+			name:       "GenerationNotObserved",
+			generation: 3,
+			status: appsv1.DeploymentStatus{
+				ObservedGeneration: 2,
+				Replicas:           1,
+				UpdatedReplicas:    1,
+				ReadyReplicas:      1,
+				AvailableReplicas:  1,
+			},
+			expectedAvailable:   configv1.ConditionTrue,
+			expectedProgressing: configv1.ConditionTrue,
+			expectedDegraded:    configv1.ConditionFalse,
+			expectedReason:      reasonDeploymentRollingOut,
+		},
+		{
+			name:       "RollingOut",
+			generation: 3,
+			status: appsv1.DeploymentStatus{
+				ObservedGeneration: 3,
+				Replicas:           2,
+				UpdatedReplicas:    1,
+				ReadyReplicas:      1,
+				AvailableReplicas:  1,
+			},
+			expectedAvailable:   configv1.ConditionTrue,
+			expectedProgressing: configv1.ConditionTrue,
+			expectedDegraded:    configv1.ConditionFalse,
+			expectedReason:      reasonDeploymentRollingOut,
+		},
+		{
+			name:       "ProgressDeadlineExceeded",
+			generation: 3,
+			status: appsv1.DeploymentStatus{
+				ObservedGeneration: 3,
+				Replicas:           1,
+				UpdatedReplicas:    1,
+				Conditions: []appsv1.DeploymentCondition{
+					{
+						Type:    appsv1.DeploymentProgressing,
+						Status:  corev1.ConditionFalse,
+						Reason:  "ProgressDeadlineExceeded",
+						Message: `ReplicaSet "metal3-5d4f8" has timed out progressing.`,
+					},
+				},
+			},
+			expectedAvailable:   configv1.ConditionFalse,
+			expectedProgressing: configv1.ConditionFalse,
+			expectedDegraded:    configv1.ConditionTrue,
+			expectedReason:      reasonDeploymentDeadlineExceeded,
+		},
+	}
+
+	for _, tc := range tCases {
+		t.Run(tc.name, func(t *testing.T) {
+			deployment := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: baremetalDeploymentName, Generation: tc.generation},
+				Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+				Status:     tc.status,
+			}
+			conditions := deploymentConditions(deployment)
+			for conditionType, expected := range map[configv1.ClusterStatusConditionType]configv1.ConditionStatus{
+				configv1.OperatorAvailable:   tc.expectedAvailable,
+				configv1.OperatorProgressing: tc.expectedProgressing,
+				configv1.OperatorDegraded:    tc.expectedDegraded,
+				OperatorDisabled:             configv1.ConditionFalse,
+			} {
+				condition := v1helpers.FindStatusCondition(conditions, conditionType)
+				if condition == nil {
+					t.Errorf("Condition %s is missing", conditionType)
+				} else if condition.Status != expected {
+					t.Errorf("Expected %s=%s, got %s: %s", conditionType, expected, condition.Status, condition.Message)
+				}
+			}
+			progressing := v1helpers.FindStatusCondition(conditions, configv1.OperatorProgressing)
+			if progressing != nil && progressing.Reason != tc.expectedReason {
+				t.Errorf("Expected Progressing reason %s, got %s", tc.expectedReason, progressing.Reason)
+			}
+		})
+	}
+}
+
+func TestStatusReporterSync(t *testing.T) {
+	fakeClient := newFakeClusterOperatorClient()
+	reporter := newStatusReporter(fakeClient, "test-namespace", "4.5.0")
+
+	replicas := int32(1)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: baremetalDeploymentName, Generation: 1},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 1,
+			Replicas:           1,
+			UpdatedReplicas:    1,
+			ReadyReplicas:      1,
+			AvailableReplicas:  1,
+		},
+	}
+
+	// The ClusterOperator is created and its status written
+	if err := reporter.sync(deploymentConditions(deployment), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	co, ok := fakeClient.clusterOperators[clusterOperatorName]
+	if !ok {
+		t.Fatalf("ClusterOperator %s was not created", clusterOperatorName)
+	}
+	if fakeClient.statusUpdates != 1 {
+		t.Errorf("Expected 1 status update, got %d", fakeClient.statusUpdates)
+	}
+	if !v1helpers.IsStatusConditionTrue(co.Status.Conditions, configv1.OperatorAvailable) {
+		t.Errorf("Expected the ClusterOperator to be Available, got %+v", co.Status.Conditions)
+	}
+	for _, expected := range []configv1.ObjectReference{
+		{Resource: "namespaces", Name: "test-namespace"},
+		{Group: "metal3.io", Resource: "provisionings", Name: baremetalProvisioningCR},
+		{Group: "apps", Resource: "deployments", Namespace: "test-namespace", Name: baremetalDeploymentName},
+		{Resource: "secrets", Namespace: "test-namespace", Name: baremetalSecretName},
+		{Resource: "configmaps", Namespace: "test-namespace", Name: baremetalConfigmap},
+	} {
+		found := false
+		for _, related := range co.Status.RelatedObjects {
+			if related == expected {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected related object %+v, got %+v", expected, co.Status.RelatedObjects)
+		}
+	}
+	if len(co.Status.Versions) != 1 || co.Status.Versions[0].Version != "4.5.0" {
+		t.Errorf("Unexpected versions %+v", co.Status.Versions)
+	}
+
+	// Unchanged conditions are not written again
+	transitionTime := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	for i := range co.Status.Conditions {
+		co.Status.Conditions[i].LastTransitionTime = transitionTime
+	}
+	if err := reporter.sync(deploymentConditions(deployment), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fakeClient.statusUpdates != 1 {
+		t.Errorf("Expected no further status update, got %d", fakeClient.statusUpdates)
+	}
+
+	// A new rollout only moves the Progressing condition
+	deployment.Generation = 2
+	if err := reporter.sync(deploymentConditions(deployment), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fakeClient.statusUpdates != 2 {
+		t.Errorf("Expected 2 status updates, got %d", fakeClient.statusUpdates)
+	}
+	available := v1helpers.FindStatusCondition(co.Status.Conditions, configv1.OperatorAvailable)
+	if available == nil || !available.LastTransitionTime.Equal(&transitionTime) {
+		t.Errorf("Expected the Available transition time to be kept, got %+v", available)
+	}
+	progressing := v1helpers.FindStatusCondition(co.Status.Conditions, configv1.OperatorProgressing)
+	if progressing == nil || progressing.Status != configv1.ConditionTrue || progressing.LastTransitionTime.Equal(&transitionTime) {
+		t.Errorf("Expected Progressing to transition to True, got %+v", progressing)
+	}
+}
+
+func TestDeploymentOperandVersions(t *testing.T) {
+	operatorConfig := &OperatorConfig{
+		TargetNamespace: "test-namespace",
+		BaremetalControllers: BaremetalControllers{
+			BaremetalOperator:         "baremetal-operator-image",
+			Ironic:                    "ironic-image",
+			IronicInspector:           "ironic-inspector-image",
+			IronicIpaDownloader:       "ironic-ipa-downloader-image",
+			IronicMachineOsDownloader: "ironic-machine-os-downloader-image",
+			IronicStaticIpManager:     "ironic-static-ip-manager-image",
+		},
+	}
+	allOperands := []string{"baremetal-operator", "ironic", "ironic-inspector", "ironic-ipa-downloader", "ironic-machine-os-downloader"}
+
+	testCases := []struct {
+		name             string
+		network          metal3v1alpha1.ProvisioningNetwork
+		updatedReplicas  int32
+		expectedOperands []string
+	}{
+		{
+			name:             "RolledOut",
+			network:          metal3v1alpha1.ProvisioningNetworkManaged,
+			updatedReplicas:  1,
+			expectedOperands: allOperands,
+		},
+		{
+			name:             "RolledOutWithoutProvisioningNetwork",
+			network:          metal3v1alpha1.ProvisioningNetworkDisabled,
+			updatedReplicas:  1,
+			expectedOperands: allOperands,
+		},
+		{
+			name:             "RollingOut",
+			network:          metal3v1alpha1.ProvisioningNetworkManaged,
+			updatedReplicas:  0,
+			expectedOperands: nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			deployment := newMetal3Deployment(operatorConfig, BaremetalProvisioningConfig{ProvisioningNetwork: tc.network}, nil)
+			deployment.Generation = 1
+			deployment.Status = appsv1.DeploymentStatus{
+				ObservedGeneration: 1,
+				Replicas:           1,
+				UpdatedReplicas:    tc.updatedReplicas,
+				ReadyReplicas:      1,
+				AvailableReplicas:  1,
+			}
+
+			operandVersions := deploymentOperandVersions(operatorConfig, deployment, "4.5.0")
+			if len(operandVersions) != len(tc.expectedOperands) {
+				t.Fatalf("Expected operands %v, got %+v", tc.expectedOperands, operandVersions)
+			}
+			for i, name := range tc.expectedOperands {
+				if operandVersions[i].Name != name || operandVersions[i].Version != "4.5.0" {
+					t.Errorf("Expected operand %s at version 4.5.0, got %+v", name, operandVersions[i])
+				}
+			}
+		})
+	}
+
+	// The CVO waits for every version declared in the manifest, so the
+	// operands must match them exactly
+	manifest, err := ioutil.ReadFile("../../../manifests/0000_30_cluster-baremetal-operator_06_clusteroperator.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	co := &configv1.ClusterOperator{}
+	if err := yaml.Unmarshal(manifest, co); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	declared := []string{}
+	for _, version := range co.Status.Versions {
+		if version.Name != "operator" {
+			declared = append(declared, version.Name)
+		}
+	}
+	reported := []string{}
+	for _, operandVersion := range allOperandVersions(operatorConfig, "4.5.0") {
+		reported = append(reported, operandVersion.Name)
+	}
+	if !reflect.DeepEqual(declared, allOperands) || !reflect.DeepEqual(reported, allOperands) {
+		t.Errorf("Expected the operands %v declared in the manifest to be reported, got %v", declared, reported)
+	}
+
+	// Operand versions are reported next to the operator version, and
+	// kept while a later rollout is in progress
+	fakeClient := newFakeClusterOperatorClient()
+	reporter := newStatusReporter(fakeClient, "test-namespace", "4.5.0")
+	operandVersions := []configv1.OperandVersion{{Name: "ironic", Version: "4.5.0"}}
+	if err := reporter.sync(nil, operandVersions); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := reporter.sync(nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	versions := fakeClient.clusterOperators[clusterOperatorName].Status.Versions
+	if len(versions) != 2 || versions[0].Name != "operator" || versions[1].Name != "ironic" {
+		t.Errorf("Unexpected versions %+v", versions)
+	}
+}
+
+func TestRunningOperandVersions(t *testing.T) {
+	operatorConfig := &OperatorConfig{
+		TargetNamespace: "test-namespace",
+		BaremetalControllers: BaremetalControllers{
+			BaremetalOperator:         "baremetal-operator-image",
+			Ironic:                    "ironic-image",
+			IronicInspector:           "ironic-inspector-image",
+			IronicIpaDownloader:       "ironic-ipa-downloader-image",
+			IronicMachineOsDownloader: "ironic-machine-os-downloader-image",
+		},
+	}
+	previousConfig := &OperatorConfig{
+		TargetNamespace: "test-namespace",
+		BaremetalControllers: BaremetalControllers{
+			BaremetalOperator:         "previous-baremetal-operator-image",
+			Ironic:                    "previous-ironic-image",
+			IronicInspector:           "previous-ironic-inspector-image",
+			IronicIpaDownloader:       "previous-ironic-ipa-downloader-image",
+			IronicMachineOsDownloader: "previous-ironic-machine-os-downloader-image",
+		},
+	}
+	rolledOut := func(config *OperatorConfig) *appsv1.Deployment {
+		deployment := newMetal3Deployment(config, BaremetalProvisioningConfig{}, nil)
+		deployment.Generation = 1
+		deployment.Status = appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+		return deployment
+	}
+
+	testCases := []struct {
+		name             string
+		deployment       *appsv1.Deployment
+		expectedOperands int
+	}{
+		{
+			name:             "NoDeployment",
+			expectedOperands: 5,
+		},
+		{
+			name:             "PreviousImages",
+			deployment:       rolledOut(previousConfig),
+			expectedOperands: 0,
+		},
+		{
+			name:             "CurrentImages",
+			deployment:       rolledOut(operatorConfig),
+			expectedOperands: 5,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeClient := &fakeObjectClient{objects: map[string]runtime.Object{}}
+			if tc.deployment != nil {
+				fakeClient.objects[objectKey(tc.deployment)] = tc.deployment
+			}
+			r := &ReconcileProvisioning{
+				client: fakeClient,
+				config: operatorConfig,
+				status: newStatusReporter(newFakeClusterOperatorClient(), "test-namespace", "4.5.0"),
+			}
+
+			operandVersions, err := r.runningOperandVersions()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(operandVersions) != tc.expectedOperands {
+				t.Errorf("Expected %d operands to be reported, got %+v", tc.expectedOperands, operandVersions)
+			}
+		})
+	}
+
+	// The Deployments being removed may still run the previous images
+	if operandVersions := removalOperandVersions(operatorConfig, []string{"Deployment/" + baremetalDeploymentName}, "4.5.0"); len(operandVersions) != 0 {
+		t.Errorf("Expected no operand to be reported during the removal, got %+v", operandVersions)
+	}
+	if operandVersions := removalOperandVersions(operatorConfig, nil, "4.5.0"); len(operandVersions) != 5 {
+		t.Errorf("Expected every operand to be reported once removed, got %+v", operandVersions)
+	}
+}
+
+func TestWorkloadConditions(t *testing.T) {
+	replicas := int32(1)
+	rolledOut := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: baremetalDeploymentName, Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 2,
+			Replicas:           1,
+			UpdatedReplicas:    1,
+			ReadyReplicas:      1,
+			AvailableReplicas:  1,
+		},
+	}
+	created := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: baremetalOperatorDeploymentName, Generation: 1},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+
+	conditions := workloadConditions([]*appsv1.Deployment{rolledOut, created})
+	for conditionType, expected := range map[configv1.ClusterStatusConditionType]configv1.ConditionStatus{
+		configv1.OperatorAvailable:   configv1.ConditionFalse,
+		configv1.OperatorProgressing: configv1.ConditionTrue,
+		configv1.OperatorDegraded:    configv1.ConditionFalse,
+		configv1.OperatorUpgradeable: configv1.ConditionTrue,
+		OperatorDisabled:             configv1.ConditionFalse,
+	} {
+		condition := v1helpers.FindStatusCondition(conditions, conditionType)
+		if condition == nil {
+			t.Errorf("Condition %s is missing", conditionType)
+		} else if condition.Status != expected {
+			t.Errorf("Expected %s=%s, got %s: %s", conditionType, expected, condition.Status, condition.Message)
+		}
+	}
+	if len(conditions) != 5 {
+		t.Errorf("Expected a single condition of each type, got %+v", conditions)
+	}
+	progressing := v1helpers.FindStatusCondition(conditions, configv1.OperatorProgressing)
+	if progressing.Reason != reasonDeploymentRollingOut {
+		t.Errorf("Expected Progressing reason %s, got %s", reasonDeploymentRollingOut, progressing.Reason)
+	}
+
+	// Once both have rolled out, the messages of both are kept
+	created = rolledOut.DeepCopy()
+	created.Name = baremetalOperatorDeploymentName
+	conditions = workloadConditions([]*appsv1.Deployment{rolledOut, created})
+	available := v1helpers.FindStatusCondition(conditions, configv1.OperatorAvailable)
+	expectedMessage := "Deployment metal3 has 1/1 ready replicas; Deployment metal3-baremetal-operator has 1/1 ready replicas"
+	if available.Status != configv1.ConditionTrue || available.Message != expectedMessage {
+		t.Errorf("Expected Available=True with message %q, got %s: %q", expectedMessage, available.Status, available.Message)
+	}
+}
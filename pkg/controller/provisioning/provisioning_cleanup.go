@@ -0,0 +1,223 @@
+package provisioning
+
+import (
+	"context"
+	"reflect"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	routev1 "github.com/openshift/api/route/v1"
+	metal3v1alpha1 "github.com/openshift/cluster-baremetal-operator/pkg/apis/metal3/v1alpha1"
+)
+
+const (
+	// provisioningFinalizer holds back the deletion of the Provisioning
+	// until the metal3 components are removed.
+	provisioningFinalizer = "metal3.io/provisioning-cleanup"
+
+	// releasedAnnotation marks the objects of the metal3 components handed
+	// over to the admin when an Unmanaged Provisioning was deleted. They
+	// are left alone until a Provisioning adopts them again.
+	releasedAnnotation = "metal3.io/released"
+)
+
+// metal3Objects returns the objects the operator creates in the target
+// namespace for the metal3 components. The Deployments come first, so
+// that the pods stop before the objects they consume are removed.
+func metal3Objects(config *OperatorConfig) []runtime.Object {
+	objectMeta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: config.TargetNamespace}
+	}
+	objects := []runtime.Object{
+		&appsv1.Deployment{ObjectMeta: objectMeta(baremetalDeploymentName)},
+		&appsv1.Deployment{ObjectMeta: objectMeta(baremetalOperatorDeploymentName)},
+		&routev1.Route{ObjectMeta: objectMeta(baremetalImageEndpoint)},
+		&corev1.Service{ObjectMeta: objectMeta(baremetalImageEndpoint)},
+		&corev1.ConfigMap{ObjectMeta: objectMeta(baremetalConfigmap)},
+		&corev1.ConfigMap{ObjectMeta: objectMeta(baremetalTrustedCAConfigMap)},
+		&corev1.PersistentVolumeClaim{ObjectMeta: objectMeta(baremetalImageCacheClaimName)},
+		&corev1.PersistentVolumeClaim{ObjectMeta: objectMeta(baremetalDatabaseClaimName)},
+	}
+	for _, name := range append(metal3PodSecrets, baremetalCASecretName) {
+		objects = append(objects, &corev1.Secret{ObjectMeta: objectMeta(name)})
+	}
+	return objects
+}
+
+// deleteMetal3Objects deletes the objects returned by metal3Objects by
+// name, including those created before they had an owner, but not those
+// released from an Unmanaged Provisioning. The Deployments are deleted in
+// the foreground, so that they are only gone once their pods are. It
+// returns the kind and name of each object still present, including those
+// already being deleted.
+func (r *ReconcileProvisioning) deleteMetal3Objects() ([]string, error) {
+	remaining := []string{}
+	foreground := metav1.DeletePropagationForeground
+	for _, object := range metal3Objects(r.config) {
+		accessor, err := meta.Accessor(object)
+		if err != nil {
+			return nil, err
+		}
+		key := client.ObjectKey{Name: accessor.GetName(), Namespace: accessor.GetNamespace()}
+		err = r.client.Get(context.TODO(), key, object)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if _, ok := accessor.GetAnnotations()[releasedAnnotation]; ok {
+			continue
+		}
+
+		err = r.client.Delete(context.TODO(), object, client.PropagationPolicy(foreground))
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		kind := reflect.TypeOf(object).Elem().Name()
+		log.Info("Deleting "+kind, kind+".Namespace", accessor.GetNamespace(), kind+".Name", accessor.GetName())
+		remaining = append(remaining, kind+"/"+accessor.GetName())
+	}
+	return remaining, nil
+}
+
+// releaseMetal3Objects removes the references to the Provisioning with
+// the given UID from the objects returned by metal3Objects, so that the
+// garbage collector does not delete them along with it, and marks them
+// with releasedAnnotation, so that they are not cleaned up afterwards.
+func (r *ReconcileProvisioning) releaseMetal3Objects(owner types.UID) error {
+	for _, object := range metal3Objects(r.config) {
+		accessor, err := meta.Accessor(object)
+		if err != nil {
+			return err
+		}
+		key := client.ObjectKey{Name: accessor.GetName(), Namespace: accessor.GetNamespace()}
+		err = r.client.Get(context.TODO(), key, object)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		ownerReferences := []metav1.OwnerReference{}
+		for _, ref := range accessor.GetOwnerReferences() {
+			if ref.UID != owner {
+				ownerReferences = append(ownerReferences, ref)
+			}
+		}
+		if _, ok := accessor.GetAnnotations()[releasedAnnotation]; ok && len(ownerReferences) == len(accessor.GetOwnerReferences()) {
+			continue
+		}
+
+		patch := client.MergeFrom(object.DeepCopyObject())
+		accessor.SetOwnerReferences(ownerReferences)
+		annotations := accessor.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[releasedAnnotation] = "true"
+		accessor.SetAnnotations(annotations)
+		kind := reflect.TypeOf(object).Elem().Name()
+		log.Info("Releasing "+kind+" from Provisioning", kind+".Namespace", accessor.GetNamespace(), kind+".Name", accessor.GetName())
+		if err := r.client.Patch(context.TODO(), object, patch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureOwnerReferences makes owner the controller of each of the objects
+// returned by metal3Objects that exists, replacing any reference to an
+// earlier Provisioning. The objects are patched, as some are applied
+// through clients that leave the owner references of existing objects
+// unchanged. Objects released from an Unmanaged Provisioning are adopted
+// again.
+func (r *ReconcileProvisioning) ensureOwnerReferences(owner metav1.OwnerReference) error {
+	for _, object := range metal3Objects(r.config) {
+		accessor, err := meta.Accessor(object)
+		if err != nil {
+			return err
+		}
+		key := client.ObjectKey{Name: accessor.GetName(), Namespace: accessor.GetNamespace()}
+		err = r.client.Get(context.TODO(), key, object)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		ownerReferences := []metav1.OwnerReference{owner}
+		for _, ref := range accessor.GetOwnerReferences() {
+			if ref.UID == owner.UID {
+				ownerReferences = nil
+				break
+			}
+			if ref.Kind != owner.Kind || ref.APIVersion != owner.APIVersion {
+				ownerReferences = append(ownerReferences, ref)
+			}
+		}
+		_, released := accessor.GetAnnotations()[releasedAnnotation]
+		if ownerReferences == nil && !released {
+			continue
+		}
+
+		patch := client.MergeFrom(object.DeepCopyObject())
+		if ownerReferences != nil {
+			accessor.SetOwnerReferences(ownerReferences)
+		}
+		if released {
+			annotations := accessor.GetAnnotations()
+			delete(annotations, releasedAnnotation)
+			accessor.SetAnnotations(annotations)
+		}
+		kind := reflect.TypeOf(object).Elem().Name()
+		log.Info("Setting the owner of "+kind, kind+".Namespace", accessor.GetNamespace(), kind+".Name", accessor.GetName())
+		if err := r.client.Patch(context.TODO(), object, patch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasFinalizer(instance *metal3v1alpha1.Provisioning) bool {
+	for _, finalizer := range instance.Finalizers {
+		if finalizer == provisioningFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureFinalizer adds the finalizer to instance, unless it already has it.
+func (r *ReconcileProvisioning) ensureFinalizer(instance *metal3v1alpha1.Provisioning) error {
+	if hasFinalizer(instance) {
+		return nil
+	}
+	instance.Finalizers = append(instance.Finalizers, provisioningFinalizer)
+	return r.client.Update(context.TODO(), instance)
+}
+
+// removeFinalizer removes the finalizer from instance, letting its
+// deletion complete.
+func (r *ReconcileProvisioning) removeFinalizer(instance *metal3v1alpha1.Provisioning) error {
+	if !hasFinalizer(instance) {
+		return nil
+	}
+	finalizers := []string{}
+	for _, finalizer := range instance.Finalizers {
+		if finalizer != provisioningFinalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	instance.Finalizers = finalizers
+	log.Info("Removing the finalizer from Provisioning", "Provisioning.Name", instance.Name)
+	return r.client.Update(context.TODO(), instance)
+}
@@ -0,0 +1,425 @@
+package provisioning
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	configv1 "github.com/openshift/api/config/v1"
+	osoperatorv1 "github.com/openshift/api/operator/v1"
+	metal3v1alpha1 "github.com/openshift/cluster-baremetal-operator/pkg/apis/metal3/v1alpha1"
+)
+
+// fakeDeleteClient marks the objects it deletes as being deleted rather
+// than removing them, like objects held by finalizers.
+type fakeDeleteClient struct {
+	*fakeObjectClient
+	deleting map[string]bool
+}
+
+func newFakeDeleteClient(objects ...runtime.Object) *fakeDeleteClient {
+	fakeClient := &fakeDeleteClient{
+		fakeObjectClient: &fakeObjectClient{objects: map[string]runtime.Object{}},
+		deleting:         map[string]bool{},
+	}
+	for _, object := range objects {
+		fakeClient.objects[objectKey(object)] = object
+	}
+	return fakeClient
+}
+
+func (f *fakeDeleteClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	key := objectKey(obj)
+	if _, ok := f.objects[key]; !ok {
+		accessor, _ := meta.Accessor(obj)
+		return apierrors.NewNotFound(schema.GroupResource{}, accessor.GetName())
+	}
+	deleteOptions := &client.DeleteOptions{}
+	deleteOptions.ApplyOptions(opts)
+	if deleteOptions.PropagationPolicy == nil || *deleteOptions.PropagationPolicy != metav1.DeletePropagationForeground {
+		return apierrors.NewBadRequest("expected foreground deletion")
+	}
+	f.deleting[key] = true
+	return nil
+}
+
+func TestDeleteMetal3Objects(t *testing.T) {
+	instance := provisioningCR.DeepCopy()
+	instance.Name = baremetalProvisioningCR
+	instance.UID = "provisioning-uid"
+	owner := []metav1.OwnerReference{*metav1.NewControllerRef(instance, metal3v1alpha1.SchemeGroupVersion.WithKind("Provisioning"))}
+	ownedMeta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, OwnerReferences: owner}
+	}
+	fakeClient := newFakeDeleteClient(
+		&appsv1.Deployment{ObjectMeta: ownedMeta(baremetalDeploymentName)},
+		&corev1.ConfigMap{ObjectMeta: ownedMeta(baremetalConfigmap)},
+		&corev1.Secret{ObjectMeta: ownedMeta(baremetalSecretName)},
+		&corev1.Secret{ObjectMeta: ownedMeta(baremetalCASecretName)},
+		&corev1.Service{ObjectMeta: ownedMeta(baremetalImageEndpoint)},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: baremetalIronicSecretName}},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: baremetalDatabaseClaimName, Annotations: map[string]string{releasedAnnotation: "true"}}},
+		&corev1.PersistentVolumeClaim{ObjectMeta: ownedMeta("unrelated-claim")},
+	)
+	r := &ReconcileProvisioning{
+		client: fakeClient,
+		config: &OperatorConfig{TargetNamespace: "test-namespace"},
+	}
+
+	remaining, err := r.deleteMetal3Objects()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{
+		"Deployment/" + baremetalDeploymentName,
+		"Service/" + baremetalImageEndpoint,
+		"ConfigMap/" + baremetalConfigmap,
+		"Secret/" + baremetalSecretName,
+		"Secret/" + baremetalIronicSecretName,
+		"Secret/" + baremetalCASecretName,
+	}
+	if !reflect.DeepEqual(remaining, expected) {
+		t.Errorf("Expected %v to remain, got %v", expected, remaining)
+	}
+	for _, key := range expected {
+		if !fakeClient.deleting[key] {
+			t.Errorf("Expected %s to be deleted", key)
+		}
+	}
+	if fakeClient.deleting["PersistentVolumeClaim/"+baremetalDatabaseClaimName] {
+		t.Errorf("Expected objects released from an Unmanaged Provisioning to be left alone")
+	}
+	if fakeClient.deleting["PersistentVolumeClaim/unrelated-claim"] {
+		t.Errorf("Expected objects not created by the operator to be left alone")
+	}
+
+	fakeClient = newFakeDeleteClient()
+	r.client = fakeClient
+	remaining, err = r.deleteMetal3Objects()
+	if err != nil || len(remaining) != 0 {
+		t.Errorf("Expected nothing to remain, got %v, %v", remaining, err)
+	}
+}
+
+func TestReconcileUnmanaged(t *testing.T) {
+	tCases := []struct {
+		name     string
+		platform configv1.PlatformType
+		deleted  bool
+	}{
+		{
+			name:     "BareMetal",
+			platform: configv1.BareMetalPlatformType,
+		},
+		{
+			name:     "Deleted",
+			platform: configv1.BareMetalPlatformType,
+			deleted:  true,
+		},
+		{
+			name:     "UnsupportedPlatform",
+			platform: configv1.AWSPlatformType,
+		},
+	}
+
+	for _, tc := range tCases {
+		t.Run(tc.name, func(t *testing.T) {
+			instance := provisioningCR.DeepCopy()
+			instance.Name = baremetalProvisioningCR
+			instance.UID = "provisioning-uid"
+			instance.Spec.ManagementState = osoperatorv1.Unmanaged
+			instance.Finalizers = []string{provisioningFinalizer}
+			if tc.deleted {
+				now := metav1.Now()
+				instance.DeletionTimestamp = &now
+			}
+			owner := *metav1.NewControllerRef(instance, metal3v1alpha1.SchemeGroupVersion.WithKind("Provisioning"))
+			other := metav1.OwnerReference{APIVersion: "v1", Kind: "ConfigMap", Name: "other", UID: "other-uid"}
+			infra := &configv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{Name: clusterConfigName},
+				Status:     configv1.InfrastructureStatus{Platform: tc.platform},
+			}
+			deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: baremetalDeploymentName, OwnerReferences: []metav1.OwnerReference{owner}}}
+			claim := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: baremetalDatabaseClaimName, OwnerReferences: []metav1.OwnerReference{owner, other}}}
+			fakeClient := newFakeDeleteClient(infra, instance, deployment, claim)
+			r := &ReconcileProvisioning{
+				client: fakeClient,
+				config: &OperatorConfig{TargetNamespace: "test-namespace"},
+				status: newStatusReporter(newFakeClusterOperatorClient(), "test-namespace", "test-version"),
+			}
+
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Name: baremetalProvisioningCR}}
+			if _, err := r.Reconcile(request); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(fakeClient.deleting) != 0 {
+				t.Errorf("Expected the metal3 components to be left alone, got %v deleted", fakeClient.deleting)
+			}
+
+			stored := fakeClient.objects[objectKey(instance)].(*metal3v1alpha1.Provisioning)
+			if hasFinalizer(stored) == tc.deleted {
+				t.Errorf("Expected the finalizer to be removed only on deletion, got %v", stored.Finalizers)
+			}
+			expected := map[string][]metav1.OwnerReference{
+				objectKey(deployment): {owner},
+				objectKey(claim):      {owner, other},
+			}
+			if tc.deleted {
+				// Released, so that the garbage collector keeps them
+				expected[objectKey(deployment)] = []metav1.OwnerReference{}
+				expected[objectKey(claim)] = []metav1.OwnerReference{other}
+			}
+			for key, expectedReferences := range expected {
+				accessor, _ := meta.Accessor(fakeClient.objects[key])
+				if !reflect.DeepEqual(accessor.GetOwnerReferences(), expectedReferences) {
+					t.Errorf("Expected %s to be owned by %v, got %v", key, expectedReferences, accessor.GetOwnerReferences())
+				}
+				if _, released := accessor.GetAnnotations()[releasedAnnotation]; released != tc.deleted {
+					t.Errorf("Expected %s to be marked as released only on deletion, got %v", key, accessor.GetAnnotations())
+				}
+			}
+
+			// Once the Provisioning is gone, the released objects are
+			// not cleaned up
+			if tc.deleted {
+				delete(fakeClient.objects, objectKey(instance))
+				if _, err := r.Reconcile(request); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if len(fakeClient.deleting) != 0 {
+					t.Errorf("Expected the released metal3 components to be left alone, got %v deleted", fakeClient.deleting)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileLeftovers(t *testing.T) {
+	tCases := []struct {
+		name     string
+		platform configv1.PlatformType
+	}{
+		{
+			name:     "UnsupportedPlatform",
+			platform: configv1.AWSPlatformType,
+		},
+		{
+			name:     "ProvisioningNotFound",
+			platform: configv1.BareMetalPlatformType,
+		},
+	}
+
+	for _, tc := range tCases {
+		t.Run(tc.name, func(t *testing.T) {
+			infra := &configv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{Name: clusterConfigName},
+				Status:     configv1.InfrastructureStatus{Platform: tc.platform},
+			}
+			// Created by an earlier version of the operator, without an
+			// owner
+			deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: baremetalDeploymentName}}
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: baremetalSecretName}}
+			fakeClient := newFakeDeleteClient(infra, deployment, secret)
+			r := &ReconcileProvisioning{
+				client: fakeClient,
+				config: &OperatorConfig{TargetNamespace: "test-namespace"},
+				status: newStatusReporter(newFakeClusterOperatorClient(), "test-namespace", "test-version"),
+			}
+
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Name: baremetalProvisioningCR}}
+			result, err := r.Reconcile(request)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for _, key := range []string{objectKey(deployment), objectKey(secret)} {
+				if !fakeClient.deleting[key] {
+					t.Errorf("Expected the leftover %s to be deleted", key)
+				}
+			}
+			if !result.Requeue {
+				t.Errorf("Expected to check again until the leftovers are gone")
+			}
+		})
+	}
+}
+
+func TestManagementStateConditions(t *testing.T) {
+	tCases := []struct {
+		name               string
+		conditions         []configv1.ClusterOperatorStatusCondition
+		expectedConditions map[configv1.ClusterStatusConditionType]configv1.ConditionStatus
+	}{
+		{
+			name:       "Unmanaged",
+			conditions: unmanagedConditions(),
+			expectedConditions: map[configv1.ClusterStatusConditionType]configv1.ConditionStatus{
+				configv1.OperatorProgressing: configv1.ConditionFalse,
+				configv1.OperatorDegraded:    configv1.ConditionFalse,
+				configv1.OperatorUpgradeable: configv1.ConditionFalse,
+				OperatorDisabled:             configv1.ConditionFalse,
+			},
+		},
+		{
+			name:       "Removing",
+			conditions: removalConditions(reasonRemoved, "", []string{"Deployment/" + baremetalDeploymentName}),
+			expectedConditions: map[configv1.ClusterStatusConditionType]configv1.ConditionStatus{
+				configv1.OperatorAvailable:   configv1.ConditionTrue,
+				configv1.OperatorProgressing: configv1.ConditionTrue,
+				configv1.OperatorDegraded:    configv1.ConditionFalse,
+				configv1.OperatorUpgradeable: configv1.ConditionTrue,
+				OperatorDisabled:             configv1.ConditionFalse,
+			},
+		},
+		{
+			name:       "Removed",
+			conditions: removalConditions(reasonRemoved, "", nil),
+			expectedConditions: map[configv1.ClusterStatusConditionType]configv1.ConditionStatus{
+				configv1.OperatorAvailable:   configv1.ConditionTrue,
+				configv1.OperatorProgressing: configv1.ConditionFalse,
+				configv1.OperatorDegraded:    configv1.ConditionFalse,
+				configv1.OperatorUpgradeable: configv1.ConditionTrue,
+				OperatorDisabled:             configv1.ConditionTrue,
+			},
+		},
+	}
+
+	for _, tc := range tCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := map[configv1.ClusterStatusConditionType]configv1.ConditionStatus{}
+			for _, condition := range tc.conditions {
+				actual[condition.Type] = condition.Status
+			}
+			if !reflect.DeepEqual(actual, tc.expectedConditions) {
+				t.Errorf("Expected %v, got %v", tc.expectedConditions, actual)
+			}
+		})
+	}
+}
+
+// fakeObjectClient stores objects in memory by kind and name. Other client
+// methods are not implemented.
+type fakeObjectClient struct {
+	client.Client
+	objects map[string]runtime.Object
+	writes  int
+}
+
+func objectKey(obj runtime.Object) string {
+	accessor, _ := meta.Accessor(obj)
+	return reflect.TypeOf(obj).Elem().Name() + "/" + accessor.GetName()
+}
+
+func (f *fakeObjectClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	existing, ok := f.objects[reflect.TypeOf(obj).Elem().Name()+"/"+key.Name]
+	if !ok {
+		return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+	}
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(existing.DeepCopyObject()).Elem())
+	return nil
+}
+
+func (f *fakeObjectClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	key := objectKey(obj)
+	if _, ok := f.objects[key]; ok {
+		accessor, _ := meta.Accessor(obj)
+		return apierrors.NewAlreadyExists(schema.GroupResource{}, accessor.GetName())
+	}
+	f.objects[key] = obj.DeepCopyObject()
+	f.writes++
+	return nil
+}
+
+func (f *fakeObjectClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	f.objects[objectKey(obj)] = obj.DeepCopyObject()
+	f.writes++
+	return nil
+}
+
+func (f *fakeObjectClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	f.objects[objectKey(obj)] = obj.DeepCopyObject()
+	f.writes++
+	return nil
+}
+
+func TestEnsureOwnerReferences(t *testing.T) {
+	instance := provisioningCR.DeepCopy()
+	instance.Name = baremetalProvisioningCR
+	instance.UID = "new-uid"
+	owner := *metav1.NewControllerRef(instance, metal3v1alpha1.SchemeGroupVersion.WithKind("Provisioning"))
+	earlier := owner
+	earlier.UID = "earlier-uid"
+	other := metav1.OwnerReference{APIVersion: "v1", Kind: "ConfigMap", Name: "other", UID: "other-uid"}
+
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: baremetalDeploymentName}}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: baremetalSecretName, OwnerReferences: []metav1.OwnerReference{earlier, other}}}
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: baremetalConfigmap, OwnerReferences: []metav1.OwnerReference{owner}}}
+	claim := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: baremetalDatabaseClaimName, Annotations: map[string]string{releasedAnnotation: "true"}}}
+	fakeClient := &fakeObjectClient{objects: map[string]runtime.Object{}}
+	for _, object := range []runtime.Object{deployment, secret, configMap, claim} {
+		fakeClient.objects[objectKey(object)] = object
+	}
+	r := &ReconcileProvisioning{
+		client: fakeClient,
+		config: &OperatorConfig{TargetNamespace: "test-namespace"},
+	}
+
+	if err := r.ensureOwnerReferences(owner); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string][]metav1.OwnerReference{
+		objectKey(deployment): {owner},
+		objectKey(secret):     {owner, other},
+		objectKey(configMap):  {owner},
+		objectKey(claim):      {owner},
+	}
+	for key, expectedReferences := range expected {
+		accessor, _ := meta.Accessor(fakeClient.objects[key])
+		if !reflect.DeepEqual(accessor.GetOwnerReferences(), expectedReferences) {
+			t.Errorf("Expected %s to be owned by %v, got %v", key, expectedReferences, accessor.GetOwnerReferences())
+		}
+	}
+	if accessor, _ := meta.Accessor(fakeClient.objects[objectKey(claim)]); len(accessor.GetAnnotations()) != 0 {
+		t.Errorf("Expected the released %s to be adopted again, got %v", objectKey(claim), accessor.GetAnnotations())
+	}
+	if fakeClient.writes != 3 {
+		t.Errorf("Expected only the objects without the owner to be patched, got %d writes", fakeClient.writes)
+	}
+}
+
+func TestProvisioningFinalizer(t *testing.T) {
+	instance := provisioningCR.DeepCopy()
+	instance.Name = baremetalProvisioningCR
+	instance.Finalizers = []string{"example.com/other"}
+	fakeClient := &fakeObjectClient{objects: map[string]runtime.Object{}}
+	r := &ReconcileProvisioning{client: fakeClient}
+
+	for i := 0; i < 2; i++ {
+		if err := r.ensureFinalizer(instance); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if expected := []string{"example.com/other", provisioningFinalizer}; !reflect.DeepEqual(instance.Finalizers, expected) {
+		t.Errorf("Expected finalizers %v, got %v", expected, instance.Finalizers)
+	}
+	if fakeClient.writes != 1 {
+		t.Errorf("Expected the finalizer to be added once, got %d writes", fakeClient.writes)
+	}
+
+	if err := r.removeFinalizer(instance); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{"example.com/other"}; !reflect.DeepEqual(instance.Finalizers, expected) {
+		t.Errorf("Expected finalizers %v, got %v", expected, instance.Finalizers)
+	}
+}
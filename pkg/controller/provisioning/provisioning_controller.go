@@ -7,9 +7,11 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	appsclientv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	coreclientv1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -20,6 +22,7 @@ import (
 
 	osconfigv1 "github.com/openshift/api/config/v1"
 	osoperatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
 	metal3v1alpha1 "github.com/openshift/cluster-baremetal-operator/pkg/apis/metal3/v1alpha1"
 	"github.com/openshift/library-go/pkg/operator/events"
 	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
@@ -32,8 +35,9 @@ var componentName = "cluster-baremetal-operator"
 
 // OperatorConfig contains configuration for the metal3 Deployment
 type OperatorConfig struct {
-	TargetNamespace      string
-	BaremetalControllers BaremetalControllers
+	TargetNamespace       string
+	BaremetalControllers  BaremetalControllers
+	MariadbPasswordLength int
 }
 
 type BaremetalControllers struct {
@@ -56,7 +60,9 @@ func newReconciler(mgr manager.Manager) reconcile.Reconciler {
 	return &ReconcileProvisioning{
 		client:     mgr.GetClient(),
 		appsClient: appsclientv1.NewForConfigOrDie(mgr.GetConfig()),
+		coreClient: coreclientv1.NewForConfigOrDie(mgr.GetConfig()),
 		scheme:     mgr.GetScheme(),
+		status:     newStatusReporter(mgr.GetClient(), componentNamespace, os.Getenv("OPERATOR_VERSION")),
 		config: &OperatorConfig{
 			TargetNamespace: componentNamespace,
 			BaremetalControllers: BaremetalControllers{
@@ -67,6 +73,7 @@ func newReconciler(mgr manager.Manager) reconcile.Reconciler {
 				IronicMachineOsDownloader: os.Getenv("IRONIC_MACHINE_OS_DOWNLOADER_IMAGE"),
 				IronicStaticIpManager:     os.Getenv("IRONIC_STATIC_IP_MANAGER_IMAGE"),
 			},
+			MariadbPasswordLength: getMariadbPasswordLength(os.Getenv("MARIADB_PASSWORD_LENGTH")),
 		},
 	}
 
@@ -86,16 +93,36 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
-	// Watch for changes to our Deployment and Secret and requeue the owner Provisioning
-	err = c.Watch(&source.Kind{Type: &appsv1.Deployment{}}, &handler.EnqueueRequestForOwner{
-		IsController: true,
-		OwnerType:    &metal3v1alpha1.Provisioning{},
-	})
+	// Watch for changes to our Deployment and Secrets and requeue the owner Provisioning.
+	// The Deployment may have been created before it had an owner, and its
+	// status is reported on the ClusterOperator, so it is matched by name.
+	// So are the Secrets consumed by the metal3 pod, whose contents are
+	// hashed into its template, and on which a password rotation is requested.
+	err = c.Watch(&source.Kind{Type: &appsv1.Deployment{}}, enqueueProvisioningFor(baremetalDeploymentName, baremetalOperatorDeploymentName))
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, enqueueProvisioningFor(append(metal3PodSecrets, baremetalCASecretName)...))
 	if err != nil {
 		return err
 	}
 
-	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestForOwner{
+	// The Service and Route of the image endpoint are repaired when
+	// changed or deleted
+	for _, imageEndpointObject := range []runtime.Object{&corev1.Service{}, &routev1.Route{}} {
+		err = c.Watch(&source.Kind{Type: imageEndpointObject}, &handler.EnqueueRequestForOwner{
+			IsController: true,
+			OwnerType:    &metal3v1alpha1.Provisioning{},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// The binding of the persistent volume claims is reported on the
+	// Provisioning status
+	err = c.Watch(&source.Kind{Type: &corev1.PersistentVolumeClaim{}}, &handler.EnqueueRequestForOwner{
 		IsController: true,
 		OwnerType:    &metal3v1alpha1.Provisioning{},
 	})
@@ -103,9 +130,41 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// The metal3-config ConfigMap may have been created before the
+	// operator took it over, so it is matched by name rather than owner.
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, enqueueProvisioningFor(metal3PodConfigMaps...))
+	if err != nil {
+		return err
+	}
+
+	// The platform, the cluster-wide proxy and the networks of the cluster
+	// are read on each reconcile, so changes to them are picked up without
+	// waiting for an unrelated event.
+	for _, clusterConfig := range []runtime.Object{&osconfigv1.Infrastructure{}, &osconfigv1.Proxy{}, &osconfigv1.Network{}} {
+		err = c.Watch(&source.Kind{Type: clusterConfig}, enqueueProvisioningFor(clusterConfigName))
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// enqueueProvisioningFor maps events for the objects called one of names
+// to the singleton Provisioning.
+func enqueueProvisioningFor(names ...string) handler.EventHandler {
+	return &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+			for _, name := range names {
+				if a.Meta.GetName() == name {
+					return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: baremetalProvisioningCR}}}
+				}
+			}
+			return nil
+		}),
+	}
+}
+
 // blank assignment to verify that ReconcileProvisioning implements reconcile.Reconciler
 var _ reconcile.Reconciler = &ReconcileProvisioning{}
 
@@ -115,13 +174,10 @@ type ReconcileProvisioning struct {
 	// that reads objects from the cache and writes to the apiserver
 	client     client.Client
 	appsClient *appsclientv1.AppsV1Client
+	coreClient *coreclientv1.CoreV1Client
 	scheme     *runtime.Scheme
 	config     *OperatorConfig
-
-	// Track latest generation of our resources in memory, which means
-	// we will re-apply on restart of the operator.
-	// TODO: persist these to CR using operator.openshift.io OperatorStatus
-	generations []osoperatorv1.GenerationStatus
+	status     *statusReporter
 }
 
 // Reconcile reads that state of the cluster for a Provisioning object and makes changes based on the state read
@@ -137,68 +193,333 @@ func (r *ReconcileProvisioning) Reconcile(request reconcile.Request) (reconcile.
 	}
 
 	infra := &osconfigv1.Infrastructure{}
-	err := r.client.Get(context.TODO(), types.NamespacedName{Name: "cluster"}, infra)
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: clusterConfigName}, infra)
 	if err != nil {
 		return reconcile.Result{}, err
 	}
 
-	// Disable ourselves on platforms other than bare metal
-	if infra.Status.Platform != osconfigv1.BareMetalPlatformType {
-		err = syncClusterOperator(r.client, r.config.TargetNamespace, os.Getenv("OPERATOR_VERSION"), true, true)
-		if err != nil {
+	// Fetch the Provisioning instance
+	instance := &metal3v1alpha1.Provisioning{}
+	err = r.client.Get(context.TODO(), request.NamespacedName, instance)
+	if errors.IsNotFound(err) {
+		instance = nil
+	} else if err != nil {
+		// Error reading the object - requeue the request.
+		return reconcile.Result{}, err
+	}
+
+	// The metal3 components were taken over by hand, so they are left as
+	// they are, even when the Provisioning is deleted
+	if instance != nil && instance.Spec.OperatorManagementState() == osoperatorv1.Unmanaged {
+		reqLogger.Info("Leaving the metal3 components as they are, as Provisioning is Unmanaged")
+		return r.leaveUnmanaged(instance)
+	}
+
+	// Remove anything left over from an earlier configuration when there
+	// is nothing to deploy, including objects created before they had an
+	// owner
+	switch {
+	case infra.Status.Platform != osconfigv1.BareMetalPlatformType:
+		// Disable ourselves on platforms other than bare metal
+		return r.cleanup(instance, reasonUnsupportedPlatform, "Nothing to do on this platform")
+	case instance == nil:
+		return r.cleanup(nil, reasonProvisioningNotFound, "There is no Provisioning to deploy the metal3 components from")
+	case instance.DeletionTimestamp != nil:
+		return r.cleanup(instance, reasonProvisioningDeleted, "The metal3 components were removed along with the Provisioning")
+	}
+
+	originalStatus := instance.Status.DeepCopy()
+
+	if instance.Spec.OperatorManagementState() == osoperatorv1.Removed {
+		return r.removeMetal3(instance, originalStatus)
+	}
+
+	// The finalizer holds back the deletion of the CR until the metal3
+	// components are removed
+	if err := r.ensureFinalizer(instance); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Changes to immutable fields are held back rather than rendered
+	applied := getAppliedProvisioning(instance)
+
+	// The webhook is not running when the installer creates the CR, so
+	// check the configuration again before rendering anything from it.
+	if err := applied.ValidateBaremetalProvisioningConfig(); err != nil {
+		// An update to the CR will trigger another reconcile; don't requeue
+		reqLogger.Error(err, "Invalid Provisioning configuration")
+		instance.Status.ObservedGeneration = instance.Generation
+		if err := r.updateProvisioningStatus(instance, originalStatus); err != nil {
 			return reconcile.Result{}, err
 		}
-		// We're disabled; don't requeue
-		return reconcile.Result{}, nil
+		// The Deployments rendered from the previous configuration are
+		// left running
+		operandVersions, versionsErr := r.runningOperandVersions()
+		if versionsErr != nil {
+			return reconcile.Result{}, versionsErr
+		}
+		return reconcile.Result{}, r.status.sync(invalidConfigurationConditions(err), operandVersions)
 	}
 
-	// Fetch the Provisioning instance
-	instance := &metal3v1alpha1.Provisioning{}
-	err = r.client.Get(context.TODO(), request.NamespacedName, instance)
+	ownerReferences := []metav1.OwnerReference{
+		*metav1.NewControllerRef(instance, metal3v1alpha1.SchemeGroupVersion.WithKind("Provisioning")),
+	}
+
+	// Create the Secrets holding the passwords needed for the Metal3 deployment
+	secret, err := r.ensurePasswordSecret(baremetalSecretName, func() (*corev1.Secret, error) {
+		return createMariadbPasswordSecret(r.config, ownerReferences)
+	})
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	ironicSecret, err := r.ensurePasswordSecret(baremetalIronicSecretName, func() (*corev1.Secret, error) {
+		return createIronicCredentialsSecret(r.config, baremetalIronicSecretName, ironicUsername, ownerReferences)
+	})
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	ironicInspectorSecret, err := r.ensurePasswordSecret(baremetalIronicInspectorSecretName, func() (*corev1.Secret, error) {
+		return createIronicCredentialsSecret(r.config, baremetalIronicInspectorSecretName, ironicInspectorUsername, ownerReferences)
+	})
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	baremetalConfig := getBaremetalProvisioningConfig(applied)
+
+	// Generate the certificates of the metal3 pod, renewing them when due
+	tlsSecret, renewTLSAfter, err := r.ensureTLSSecrets(baremetalConfig, ownerReferences)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			// Request object not found, could have been deleted after reconcile request.
-			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
-			// Return and don't requeue
-			return reconcile.Result{}, nil
-		}
-		// Error reading the object - requeue the request.
 		return reconcile.Result{}, err
 	}
 
-	// Create a Secret needed for the Metal3 deployment
-	foundSecret := &corev1.Secret{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: baremetalSecretName, Namespace: r.config.TargetNamespace}, foundSecret)
-	if err != nil && errors.IsNotFound(err) {
-		// Secret does not already exist. So, create one.
-		secret := createMariadbPasswordSecret(r.config)
-		reqLogger.Info("Creating a new Maridb password secret", "Secret.Namespace", secret.Namespace, "Deployment.Name", secret.Name)
-		err := r.client.Create(context.TODO(), secret)
+	// Create the persistent volume claims of the metal3 pod, if any
+	claims, err := r.ensureStorageClaims(newStorageClaims(r.config, baremetalConfig, ownerReferences))
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	setStorageConditions(instance, claims)
+
+	// Expose the images for virtual media boot on the external network
+	if baremetalConfig.VirtualMediaViaExternalNetwork {
+		externalHttpURL, err := r.ensureImageEndpoint(ownerReferences)
 		if err != nil {
 			return reconcile.Result{}, err
 		}
-	} else if err != nil {
+		if externalHttpURL == nil {
+			// The Route is watched, so the host assigned by the
+			// router triggers another reconcile
+			reqLogger.Info("Waiting for the image endpoint Route to be assigned a host")
+		} else {
+			baremetalConfig.ExternalHttpURL = *externalHttpURL
+		}
+	}
+
+	// Pass the cluster-wide proxy on to the containers downloading images
+	// and to Ironic
+	if err := r.setProxyConfig(&baremetalConfig); err != nil {
 		return reconcile.Result{}, err
 	}
+	if usesProxy(baremetalConfig) {
+		if err := r.ensureTrustedCAConfigMap(ownerReferences); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
 
-	// Define a new Deployment object
-	deployment := newMetal3Deployment(r.config, getBaremetalProvisioningConfig(instance))
-	expectedGeneration := resourcemerge.ExpectedDeploymentGeneration(deployment, r.generations)
-	_, updated, err := resourceapply.ApplyDeployment(r.appsClient, events.NewLoggingEventRecorder(componentName), deployment, expectedGeneration, false)
+	// Generate the metal3-config ConfigMap, replacing any changes made to it
+	configMap := newMetal3ConfigMap(r.config, baremetalConfig)
+	configMap.OwnerReferences = ownerReferences
+	_, updated, err := resourceapply.ApplyConfigMap(r.coreClient, events.NewLoggingEventRecorder(componentName), configMap)
 	if err != nil {
 		return reconcile.Result{}, err
 	} else if updated {
-		reqLogger.Info("Successfully created or updated Deployment", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
-		resourcemerge.SetDeploymentGeneration(&r.generations, deployment)
-	} else {
-		reqLogger.Info("Skip reconcile: Deployment already up to date", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
+		reqLogger.Info("Successfully created or updated ConfigMap", "ConfigMap.Namespace", configMap.Namespace, "ConfigMap.Name", configMap.Name)
+	}
+
+	// Define the Deployments of the workload layout
+	secrets := []*corev1.Secret{secret, ironicSecret, ironicInspectorSecret, tlsSecret}
+	deployments := []*appsv1.Deployment{newMetal3Deployment(r.config, baremetalConfig, secrets)}
+	if isSplitLayout(baremetalConfig) {
+		deployments = append(deployments, newBaremetalOperatorDeployment(r.config, baremetalConfig, secrets))
+	} else if err := r.deleteDeployment(baremetalOperatorDeploymentName); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	actualDeployments := []*appsv1.Deployment{}
+	for _, deployment := range deployments {
+		deployment.OwnerReferences = ownerReferences
+		if err := setSpecHashAnnotation(deployment); err != nil {
+			return reconcile.Result{}, err
+		}
+		expectedGeneration := resourcemerge.ExpectedDeploymentGeneration(deployment, instance.Status.Generations)
+		actualDeployment, updated, err := resourceapply.ApplyDeployment(r.appsClient, events.NewLoggingEventRecorder(componentName), deployment, expectedGeneration, false)
+		if err != nil {
+			return reconcile.Result{}, err
+		} else if updated {
+			reqLogger.Info("Successfully created or updated Deployment", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
+		} else {
+			reqLogger.Info("Skip reconcile: Deployment already up to date", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
+		}
+		actualDeployments = append(actualDeployments, actualDeployment)
+	}
+
+	// Objects created before they had an owner are only garbage
+	// collected once they are given one
+	if err := r.ensureOwnerReferences(ownerReferences[0]); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	setDeploymentStatus(instance, actualDeployments)
+	instance.Status.AppliedSpec = applied.Spec.DeepCopy()
+	instance.Status.EffectiveDHCPRange = ""
+	if baremetalConfig.ProvisioningNetwork == metal3v1alpha1.ProvisioningNetworkManaged {
+		dhcpRange := getEffectiveDHCPRange(baremetalConfig.ProvisioningIp, baremetalConfig.ProvisioningNetworkCIDR,
+			baremetalConfig.ProvisioningDHCPRange, baremetalConfig.ProvisioningIPv6AddressMode)
+		if dhcpRange != nil {
+			instance.Status.EffectiveDHCPRange = *dhcpRange
+		}
+	}
+	instance.Status.ExposedPorts = getExposedPorts(baremetalConfig)
+	err = r.updateProvisioningStatus(instance, originalStatus)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	err = r.status.sync(workloadConditions(actualDeployments), workloadOperandVersions(r.config, actualDeployments, r.status.version))
+	if err != nil {
+		return reconcile.Result{}, err
 	}
 
-	err = syncClusterOperator(r.client, r.config.TargetNamespace, os.Getenv("OPERATOR_VERSION"), true, false)
+	// Success; requeue to renew the certificates when they are due
+	return reconcile.Result{RequeueAfter: renewTLSAfter}, nil
+}
+
+// removeMetal3 deletes the metal3 components when the management state of
+// instance is Removed, and reports their removal.
+func (r *ReconcileProvisioning) removeMetal3(instance *metal3v1alpha1.Provisioning, originalStatus *metal3v1alpha1.ProvisioningStatus) (reconcile.Result, error) {
+	remaining, err := r.deleteMetal3Objects()
 	if err != nil {
 		return reconcile.Result{}, err
 	}
 
-	// Success; don't requeue
-	return reconcile.Result{}, nil
+	setRemovedStatus(instance)
+	if err := r.updateProvisioningStatus(instance, originalStatus); err != nil {
+		return reconcile.Result{}, err
+	}
+	message := "The metal3 components were removed, as the Provisioning managementState is Removed"
+	if err := r.status.sync(removalConditions(reasonRemoved, message, remaining), removalOperandVersions(r.config, remaining, r.status.version)); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Not every object being deleted is watched, so check again until
+	// they are all gone
+	return reconcile.Result{Requeue: len(remaining) > 0}, nil
+}
+
+// leaveUnmanaged writes nothing but the ClusterOperator. When instance is
+// being deleted, the metal3 components are released from it before its
+// finalizer is removed, so that they outlive it.
+func (r *ReconcileProvisioning) leaveUnmanaged(instance *metal3v1alpha1.Provisioning) (reconcile.Result, error) {
+	if instance.DeletionTimestamp != nil {
+		if err := r.releaseMetal3Objects(instance.UID); err != nil {
+			return reconcile.Result{}, err
+		}
+		if err := r.removeFinalizer(instance); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	operandVersions, err := r.runningOperandVersions()
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{}, r.status.sync(unmanagedConditions(), operandVersions)
+}
+
+// runningOperandVersions returns the versions of the operands run by the
+// metal3 Deployments, for when they are left as they are rather than
+// rolled out. Without any, every operand is reported at the operator
+// version, as there is no rollout to wait for.
+func (r *ReconcileProvisioning) runningOperandVersions() ([]osconfigv1.OperandVersion, error) {
+	deployments := []*appsv1.Deployment{}
+	for _, name := range []string{baremetalDeploymentName, baremetalOperatorDeploymentName} {
+		deployment := &appsv1.Deployment{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: r.config.TargetNamespace}, deployment)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		deployments = append(deployments, deployment)
+	}
+	if len(deployments) == 0 {
+		return allOperandVersions(r.config, r.status.version), nil
+	}
+	return workloadOperandVersions(r.config, deployments, r.status.version), nil
+}
+
+// cleanup deletes the metal3 components and reports their removal for
+// reason. Once they are gone, the finalizer is removed from instance if it
+// is being deleted.
+func (r *ReconcileProvisioning) cleanup(instance *metal3v1alpha1.Provisioning, reason, message string) (reconcile.Result, error) {
+	remaining, err := r.deleteMetal3Objects()
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if len(remaining) == 0 && instance != nil && instance.DeletionTimestamp != nil {
+		if err := r.removeFinalizer(instance); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	if err := r.status.sync(removalConditions(reason, message, remaining), removalOperandVersions(r.config, remaining, r.status.version)); err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{Requeue: len(remaining) > 0}, nil
+}
+
+// ensurePasswordSecret creates the Secret called name, as returned by
+// newSecret, when it does not exist yet. Otherwise it rotates the password
+// it holds when requested.
+func (r *ReconcileProvisioning) ensurePasswordSecret(name string, newSecret func() (*corev1.Secret, error)) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: r.config.TargetNamespace}, secret)
+	if errors.IsNotFound(err) {
+		secret, err = newSecret()
+		if err != nil {
+			return nil, err
+		}
+		log.Info("Creating a new password secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		return secret, r.client.Create(context.TODO(), secret)
+	} else if err != nil {
+		return nil, err
+	}
+
+	rotated, err := rotatePassword(r.config, secret)
+	if err != nil {
+		return nil, err
+	}
+	if rotated {
+		log.Info("Rotating the password", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		if err := r.client.Update(context.TODO(), secret); err != nil {
+			return nil, err
+		}
+	}
+	return secret, nil
+}
+
+// deleteDeployment deletes the Deployment called name, which is no longer
+// part of the workload layout, if it exists.
+func (r *ReconcileProvisioning) deleteDeployment(name string) error {
+	deployment := &appsv1.Deployment{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: r.config.TargetNamespace}, deployment)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	log.Info("Deleting Deployment", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
+	err = r.client.Delete(context.TODO(), deployment)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
 }
@@ -0,0 +1,117 @@
+package provisioning
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+
+	osoperatorv1 "github.com/openshift/api/operator/v1"
+	metal3v1alpha1 "github.com/openshift/cluster-baremetal-operator/pkg/apis/metal3/v1alpha1"
+	"github.com/openshift/library-go/pkg/operator/resource/resourcemerge"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+)
+
+const (
+	// provisioningImmutableFieldsDegraded is the Provisioning status
+	// condition reporting a held back change to an immutable field.
+	provisioningImmutableFieldsDegraded = "ImmutableFieldsDegraded"
+
+	reasonImmutableFieldsChanged = "ImmutableFieldsChanged"
+	reasonAsExpected             = "AsExpected"
+)
+
+// getAppliedProvisioning returns a copy of the Provisioning CR holding the
+// configuration that should be rendered. Changes to fields that are
+// immutable after creation are replaced by the previously applied values,
+// and the outcome is recorded as a condition on the status of instance.
+func getAppliedProvisioning(instance *metal3v1alpha1.Provisioning) *metal3v1alpha1.Provisioning {
+	applied := instance.DeepCopy()
+	previous := instance.Status.AppliedSpec
+	if previous == nil {
+		// Nothing was rendered yet, so the whole spec is accepted
+		setImmutableFieldsCondition(instance, nil)
+		return applied
+	}
+
+	err := instance.ValidateImmutableFields(previous)
+	setImmutableFieldsCondition(instance, err)
+	if err != nil {
+		// The DHCP ranges, the workload layout, the storage, the
+		// container resources, the host firewall and the management
+		// state are the only fields allowed to change
+		current := applied.Spec
+		applied.Spec = *previous.DeepCopy()
+		applied.Spec.ProvisioningDHCPRange = current.ProvisioningDHCPRange
+		applied.Spec.ProvisioningSecondaryDHCPRange = current.ProvisioningSecondaryDHCPRange
+		applied.Spec.WorkloadLayout = current.WorkloadLayout
+		applied.Spec.Storage = current.Storage
+		applied.Spec.ContainerResources = current.ContainerResources
+		applied.Spec.ManageHostFirewall = current.ManageHostFirewall
+		applied.Spec.ManagementState = current.ManagementState
+	}
+	return applied
+}
+
+func setImmutableFieldsCondition(instance *metal3v1alpha1.Provisioning, err error) {
+	condition := osoperatorv1.OperatorCondition{
+		Type:   provisioningImmutableFieldsDegraded,
+		Status: osoperatorv1.ConditionFalse,
+		Reason: reasonAsExpected,
+	}
+	if err != nil {
+		condition.Status = osoperatorv1.ConditionTrue
+		condition.Reason = reasonImmutableFieldsChanged
+		condition.Message = "Changes held back, the previously applied values remain in use: " + err.Error()
+	}
+	v1helpers.SetOperatorCondition(&instance.Status.Conditions, condition)
+}
+
+// setDeploymentStatus records on the status of instance the generation of
+// each applied Deployment, so that changes made to them by others are
+// detected and reverted after a restart of the operator. Deployments that
+// are no longer applied are forgotten. The ready replicas are those of the
+// Deployment with the fewest.
+func setDeploymentStatus(instance *metal3v1alpha1.Provisioning, deployments []*appsv1.Deployment) {
+	applied := map[string]bool{}
+	for _, deployment := range deployments {
+		applied[deployment.Namespace+"/"+deployment.Name] = true
+	}
+	generations := []osoperatorv1.GenerationStatus{}
+	for _, generation := range instance.Status.Generations {
+		if generation.Group == appsv1.GroupName && generation.Resource == "deployments" &&
+			!applied[generation.Namespace+"/"+generation.Name] {
+			continue
+		}
+		generations = append(generations, generation)
+	}
+	instance.Status.Generations = generations
+
+	instance.Status.ObservedGeneration = instance.Generation
+	for i, deployment := range deployments {
+		resourcemerge.SetDeploymentGeneration(&instance.Status.Generations, deployment)
+		if i == 0 || deployment.Status.ReadyReplicas < instance.Status.ReadyReplicas {
+			instance.Status.ReadyReplicas = deployment.Status.ReadyReplicas
+		}
+	}
+}
+
+// setRemovedStatus clears the parts of the status of instance describing
+// the metal3 components, once they are removed. The applied spec is kept,
+// so that changes to immutable fields are still held back should the
+// components be managed again.
+func setRemovedStatus(instance *metal3v1alpha1.Provisioning) {
+	setDeploymentStatus(instance, nil)
+	instance.Status.ReadyReplicas = 0
+	instance.Status.EffectiveDHCPRange = ""
+	instance.Status.ExposedPorts = nil
+}
+
+// updateProvisioningStatus writes the status of instance through the
+// status subresource, but only if it differs from original.
+func (r *ReconcileProvisioning) updateProvisioningStatus(instance *metal3v1alpha1.Provisioning, original *metal3v1alpha1.ProvisioningStatus) error {
+	if equality.Semantic.DeepEqual(&instance.Status, original) {
+		return nil
+	}
+	return r.client.Status().Update(context.TODO(), instance)
+}
@@ -0,0 +1,97 @@
+package provisioning
+
+import (
+	"testing"
+
+	osoperatorv1 "github.com/openshift/api/operator/v1"
+	metal3v1alpha1 "github.com/openshift/cluster-baremetal-operator/pkg/apis/metal3/v1alpha1"
+	"github.com/openshift/library-go/pkg/operator/resource/resourcemerge"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+func TestGetAppliedProvisioning(t *testing.T) {
+	instance := provisioningCR.DeepCopy()
+
+	// The first reconcile accepts the whole spec
+	applied := getAppliedProvisioning(instance)
+	if !equality.Semantic.DeepEqual(applied.Spec, instance.Spec) {
+		t.Fatalf("expected the spec to be applied unchanged, got %+v", applied.Spec)
+	}
+	if !v1helpers.IsOperatorConditionFalse(instance.Status.Conditions, provisioningImmutableFieldsDegraded) {
+		t.Errorf("expected %s to be False, got %+v", provisioningImmutableFieldsDegraded, instance.Status.Conditions)
+	}
+	instance.Status.AppliedSpec = applied.Spec.DeepCopy()
+
+	// Immutable changes are held back while the DHCP range rolls out
+	instance.Spec.ProvisioningIP = "172.30.20.4"
+	instance.Spec.ProvisioningDHCPRange = "172.30.20.20, 172.30.20.120"
+	applied = getAppliedProvisioning(instance)
+	if applied.Spec.ProvisioningIP != expectedProvisioningIP {
+		t.Errorf("expected provisioning IP %s to be held back, got %s", expectedProvisioningIP, applied.Spec.ProvisioningIP)
+	}
+	if applied.Spec.ProvisioningDHCPRange != "172.30.20.20, 172.30.20.120" {
+		t.Errorf("expected the DHCP range change to be applied, got %s", applied.Spec.ProvisioningDHCPRange)
+	}
+	condition := v1helpers.FindOperatorCondition(instance.Status.Conditions, provisioningImmutableFieldsDegraded)
+	if condition == nil || condition.Status != osoperatorv1.ConditionTrue || condition.Reason != reasonImmutableFieldsChanged {
+		t.Errorf("expected %s to be True with reason %s, got %+v", provisioningImmutableFieldsDegraded, reasonImmutableFieldsChanged, condition)
+	}
+
+	// Reverting the change clears the condition
+	instance.Spec.ProvisioningIP = expectedProvisioningIP
+	getAppliedProvisioning(instance)
+	if !v1helpers.IsOperatorConditionFalse(instance.Status.Conditions, provisioningImmutableFieldsDegraded) {
+		t.Errorf("expected %s to be False after reverting, got %+v", provisioningImmutableFieldsDegraded, instance.Status.Conditions)
+	}
+}
+
+func TestSetDeploymentStatus(t *testing.T) {
+	instance := provisioningCR.DeepCopy()
+	instance.Generation = 3
+	deployment := newMetal3Deployment(&OperatorConfig{TargetNamespace: "test-namespace"}, getBaremetalProvisioningConfig(instance), nil)
+	deployment.Generation = 5
+	deployment.Status.ReadyReplicas = 1
+
+	// Nothing was applied yet, so any existing Deployment is replaced
+	if expected := resourcemerge.ExpectedDeploymentGeneration(deployment, instance.Status.Generations); expected != -1 {
+		t.Errorf("expected no recorded generation, got %d", expected)
+	}
+
+	setDeploymentStatus(instance, []*appsv1.Deployment{deployment})
+	if expected := resourcemerge.ExpectedDeploymentGeneration(deployment, instance.Status.Generations); expected != 5 {
+		t.Errorf("expected the recorded generation to be 5, got %d", expected)
+	}
+	if instance.Status.ObservedGeneration != 3 {
+		t.Errorf("expected observed generation 3, got %d", instance.Status.ObservedGeneration)
+	}
+	if instance.Status.ReadyReplicas != 1 {
+		t.Errorf("expected 1 ready replica, got %d", instance.Status.ReadyReplicas)
+	}
+
+	// A later rollout replaces the recorded generation
+	deployment.Generation = 6
+	setDeploymentStatus(instance, []*appsv1.Deployment{deployment})
+	if len(instance.Status.Generations) != 1 || instance.Status.Generations[0].LastGeneration != 6 {
+		t.Errorf("expected a single recorded generation of 6, got %+v", instance.Status.Generations)
+	}
+
+	// With the Split layout, the fewest ready replicas are reported
+	instance.Spec.WorkloadLayout = metal3v1alpha1.WorkloadLayoutSplit
+	operatorDeployment := newBaremetalOperatorDeployment(&OperatorConfig{TargetNamespace: "test-namespace"}, getBaremetalProvisioningConfig(instance), nil)
+	operatorDeployment.Generation = 1
+	setDeploymentStatus(instance, []*appsv1.Deployment{deployment, operatorDeployment})
+	if len(instance.Status.Generations) != 2 {
+		t.Errorf("expected two recorded generations, got %+v", instance.Status.Generations)
+	}
+	if instance.Status.ReadyReplicas != 0 {
+		t.Errorf("expected 0 ready replicas, got %d", instance.Status.ReadyReplicas)
+	}
+
+	// Going back to the Combined layout forgets the removed Deployment
+	setDeploymentStatus(instance, []*appsv1.Deployment{deployment})
+	if expected := resourcemerge.ExpectedDeploymentGeneration(operatorDeployment, instance.Status.Generations); expected != -1 {
+		t.Errorf("expected the removed Deployment to be forgotten, got generation %d", expected)
+	}
+}